@@ -27,6 +27,7 @@ import (
 	"github.com/fatih/structs"
 	"github.com/jawher/mow.cli"
 	"github.com/kumoru/kumoru-sdk-go/client/kumoru/utils"
+	"github.com/kumoru/kumoru-sdk-go/pkg/kumoru"
 	"github.com/kumoru/kumoru-sdk-go/pkg/service/authorization"
 	"github.com/ryanuber/columnize"
 	"golang.org/x/crypto/ssh/terminal"
@@ -77,6 +78,10 @@ func Create(cmd *cli.Cmd) {
 			log.Fatalf("Could not create account: %s", errs[0])
 		}
 
+		if kumoru.IsDryRun(resp) {
+			return
+		}
+
 		if resp.StatusCode != 201 {
 			log.Fatalf("Could not create account: %s", resp.Status)
 		}
@@ -131,6 +136,10 @@ func ResetPassword(cmd *cli.Cmd) {
 			log.Fatalf("Could not retrieve account: %s", errs[0])
 		}
 
+		if kumoru.IsDryRun(resp) {
+			return
+		}
+
 		if resp.StatusCode != 204 {
 			log.Fatalf("Could not reset account password: %s", resp.Status)
 		}
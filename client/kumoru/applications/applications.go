@@ -18,6 +18,7 @@ package applications
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -30,6 +31,7 @@ import (
 	"github.com/fatih/structs"
 	"github.com/jawher/mow.cli"
 	"github.com/kumoru/kumoru-sdk-go/client/kumoru/utils"
+	"github.com/kumoru/kumoru-sdk-go/pkg/kumoru"
 	"github.com/kumoru/kumoru-sdk-go/pkg/service/application"
 	"github.com/ryanuber/columnize"
 )
@@ -53,6 +55,10 @@ func Archive(cmd *cli.Cmd) {
 			log.Fatalf("Could not archive applications: %s", errs)
 		}
 
+		if kumoru.IsDryRun(resp) {
+			return
+		}
+
 		if resp.StatusCode != 202 {
 			log.Fatalf("Could not archive applications: %s", resp.Status)
 		}
@@ -169,6 +175,10 @@ func Create(cmd *cli.Cmd) {
 			log.Fatalf("Could not create application: %s", errs[0])
 		}
 
+		if kumoru.IsDryRun(resp) {
+			return
+		}
+
 		if resp.StatusCode != 201 {
 			log.Fatalf("Could not create application: %s", resp.Status)
 		}
@@ -206,6 +216,10 @@ func Deploy(cmd *cli.Cmd) {
 			log.Fatalf("Could not deploy application: %s", errs)
 		}
 
+		if kumoru.IsDryRun(resp) {
+			return
+		}
+
 		if resp.StatusCode != 202 {
 			log.Fatalf("Could not deploy application: %s", resp.Status)
 		}
@@ -220,22 +234,28 @@ func List(cmd *cli.Cmd) {
 	var a []application.Application
 
 	all := cmd.BoolOpt("a all", false, "List all applications, including archived")
+	pages := utils.PageFlags(cmd, "applications")
 
 	cmd.Action = func() {
-		resp, body, errs := application.List()
+		opts := pages()
 
-		if errs != nil {
-			log.Fatalf("Could not retrieve applications: %s", errs)
+		// Archived applications are skipped here, so --limit counts the applications shown.
+		limit := opts.Limit
+		if !*all {
+			opts.Limit = 0
 		}
 
-		if resp.StatusCode != 200 {
-			log.Fatalf("Could not retrieve applications: %s", resp.Status)
-		}
+		it := application.NewService(kumoru.New()).Iterate(opts)
 
-		err := json.Unmarshal([]byte(body), &a)
+		for (limit == 0 || len(a) < limit) && it.Next(context.Background()) {
+			app := it.Application()
+			if *all || strings.ToLower(string(app.Status)) != "archived" {
+				a = append(a, *app)
+			}
+		}
 
-		if err != nil {
-			log.Fatal(err)
+		if err := it.Err(); err != nil {
+			log.Fatalf("Could not retrieve applications: %s", err)
 		}
 
 		printAppBrief(a, *all)
@@ -350,6 +370,10 @@ func Patch(cmd *cli.Cmd) {
 			log.Fatalf("Could not patch application: %s", errs[0])
 		}
 
+		if kumoru.IsDryRun(resp) {
+			return
+		}
+
 		if resp.StatusCode != 200 {
 			log.Fatalf("Could not patch application: %s", resp.Status)
 		}
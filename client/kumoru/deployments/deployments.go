@@ -17,6 +17,7 @@ limitations under the License.
 package deployments
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 
@@ -25,6 +26,7 @@ import (
 	"github.com/fatih/structs"
 	"github.com/jawher/mow.cli"
 	"github.com/kumoru/kumoru-sdk-go/client/kumoru/utils"
+	"github.com/kumoru/kumoru-sdk-go/pkg/kumoru"
 	"github.com/kumoru/kumoru-sdk-go/pkg/service/application/deployments"
 	"github.com/ryanuber/columnize"
 )
@@ -36,19 +38,21 @@ func List(cmd *cli.Cmd) {
 		HideValue: true,
 	})
 
+	pages := utils.PageFlags(cmd, "deployments")
+
 	cmd.Action = func() {
-		d := deployments.Deployment{}
-		deployments, resp, errs := d.List(*uuid)
+		var d []deployments.Deployment
 
-		if len(errs) > 0 {
-			log.Fatalf("Could not retrieve deployments: %s", errs[0])
+		it := deployments.NewService(kumoru.New()).Iterate(*uuid, pages())
+		for it.Next(context.Background()) {
+			d = append(d, *it.Deployment())
 		}
 
-		if resp.StatusCode != 200 {
-			log.Fatalf("Could not retrieve deployments: %s", resp.Status)
+		if err := it.Err(); err != nil {
+			log.Fatalf("Could not retrieve deployments: %s", err)
 		}
 
-		printDeploymentsBrief(*deployments)
+		printDeploymentsBrief(d)
 	}
 }
 
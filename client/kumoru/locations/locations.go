@@ -17,12 +17,15 @@ limitations under the License.
 package locations
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 
 	log "github.com/Sirupsen/logrus"
 
 	"github.com/jawher/mow.cli"
+	"github.com/kumoru/kumoru-sdk-go/client/kumoru/utils"
+	"github.com/kumoru/kumoru-sdk-go/pkg/kumoru"
 	"github.com/kumoru/kumoru-sdk-go/pkg/service/location"
 	"github.com/ryanuber/columnize"
 )
@@ -47,13 +50,17 @@ func Add(cmd *cli.Cmd) {
 			Region:   *identifier,
 		}
 
-		body, errs := l.Create()
+		body, resp, err := location.NewService(kumoru.New()).Create(context.Background(), &l)
 
-		if len(errs) > 0 {
-			log.Fatalf("Could not add new location: %s", errs)
+		if err != nil {
+			log.Fatalf("Could not add new location: %s", err)
+		}
+
+		if kumoru.IsDryRun(resp) {
+			return
 		}
 
-		err := json.Unmarshal([]byte(body), &l)
+		err = json.Unmarshal([]byte(body), &l)
 
 		if err != nil {
 			log.Fatal(err)
@@ -84,10 +91,14 @@ func Delete(cmd *cli.Cmd) {
 		}
 
 		//TODO determine if there are any applications in the location and prompt user to remove them
-		errs := l.Delete()
+		resp, err := location.NewService(kumoru.New()).Delete(context.Background(), &l)
+
+		if err != nil {
+			log.Fatalf("Could not delete location: %s", err)
+		}
 
-		if len(errs) > 0 {
-			log.Fatalf("Could not delete location: %s", errs)
+		if kumoru.IsDryRun(resp) {
+			return
 		}
 
 		fmt.Printf("Deleting location %s-%s", *provider, *identifier)
@@ -108,26 +119,26 @@ func List(cmd *cli.Cmd) {
 		HideValue: true,
 	})
 
+	pages := utils.PageFlags(cmd, "locations")
+
 	cmd.Action = func() {
 		l := location.Location{
 			Provider: *provider,
 			Region:   *identifier,
 		}
 
-		body, errs := l.Find()
+		var locations []location.Location
 
-		if len(errs) > 0 {
-			log.Fatalf("Could not retrieve locations: %s", errs[0])
+		it := location.NewService(kumoru.New()).Iterate(&l, pages())
+		for it.Next(context.Background()) {
+			locations = append(locations, *it.Location())
 		}
 
-		locations := &[]location.Location{}
-		err := json.Unmarshal([]byte(body), locations)
-
-		if err != nil {
-			log.Fatal(err)
+		if err := it.Err(); err != nil {
+			log.Fatalf("Could not retrieve locations: %s", err)
 		}
 
-		PrintLocationBrief(*locations)
+		PrintLocationBrief(locations)
 	}
 }
 
@@ -19,6 +19,7 @@ package main
 import (
 	"fmt"
 	"os"
+	"strings"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/jawher/mow.cli"
@@ -29,6 +30,7 @@ import (
 	"github.com/kumoru/kumoru-sdk-go/client/kumoru/locations"
 	"github.com/kumoru/kumoru-sdk-go/client/kumoru/secrets"
 	"github.com/kumoru/kumoru-sdk-go/client/kumoru/tokens"
+	"github.com/kumoru/kumoru-sdk-go/pkg/kumoru"
 )
 
 func init() {
@@ -50,7 +52,98 @@ func main() {
 
 	app.Version("v version", BuildVersion)
 
+	profile := app.String(cli.StringOpt{
+		Name:      "profile",
+		Desc:      "Configuration profile to use from ~/.kumoru/config",
+		EnvVar:    "KUMORU_PROFILE",
+		Value:     "default",
+		HideValue: true,
+	})
+
+	caBundle := app.String(cli.StringOpt{
+		Name:      "ca-bundle",
+		Desc:      "PEM file of additional certificates to trust (i.e. a corporate proxy CA)",
+		EnvVar:    "KUMORU_CA_BUNDLE",
+		HideValue: true,
+	})
+
+	pins := app.Strings(cli.StringsOpt{
+		Name:      "pin",
+		Desc:      "Base64 SHA-256 digest of a public key the server's certificate chain must contain",
+		HideValue: true,
+	})
+
+	clientCert := app.String(cli.StringOpt{
+		Name:      "client-cert",
+		Desc:      "PEM certificate to present to gateways requiring mutual TLS",
+		EnvVar:    "KUMORU_TLS_CLIENT_CERT",
+		HideValue: true,
+	})
+
+	clientKey := app.String(cli.StringOpt{
+		Name:      "client-key",
+		Desc:      "PEM private key of --client-cert",
+		EnvVar:    "KUMORU_TLS_CLIENT_KEY",
+		HideValue: true,
+	})
+
+	clientPKCS12 := app.String(cli.StringOpt{
+		Name:      "client-pkcs12",
+		Desc:      "PKCS#12 file holding the client certificate and key (password in KUMORU_TLS_CLIENT_PKCS12_PASSWORD)",
+		EnvVar:    "KUMORU_TLS_CLIENT_PKCS12",
+		HideValue: true,
+	})
+
+	insecure := app.Bool(cli.BoolOpt{
+		Name:      "insecure",
+		Desc:      "Do not verify server certificates (WARNING: for local testing only)",
+		EnvVar:    "KUMORU_TLS_INSECURE",
+		Value:     false,
+		HideValue: true,
+	})
+
+	dryRun := app.Bool(cli.BoolOpt{
+		Name:      "dry-run",
+		Desc:      "Print the requests which would change anything instead of sending them",
+		EnvVar:    "KUMORU_DRY_RUN",
+		Value:     false,
+		HideValue: true,
+	})
+
+	// Commands build their clients from the environment, so global options are passed through it.
+	app.Before = func() {
+		os.Setenv("KUMORU_PROFILE", *profile)
+		kumoru.PassphraseFunc = tokens.Passphrase
+
+		if *caBundle != "" {
+			os.Setenv("KUMORU_CA_BUNDLE", *caBundle)
+		}
+
+		if len(*pins) > 0 {
+			os.Setenv("KUMORU_TLS_PINS", strings.Join(*pins, ","))
+		}
+
+		if *clientCert != "" || *clientKey != "" {
+			os.Setenv("KUMORU_TLS_CLIENT_CERT", *clientCert)
+			os.Setenv("KUMORU_TLS_CLIENT_KEY", *clientKey)
+		}
+
+		if *clientPKCS12 != "" {
+			os.Setenv("KUMORU_TLS_CLIENT_PKCS12", *clientPKCS12)
+		}
+
+		if *dryRun {
+			os.Setenv("KUMORU_DRY_RUN", "true")
+		}
+
+		if *insecure {
+			log.Warn("TLS certificate verification is disabled")
+			os.Setenv("KUMORU_TLS_INSECURE", "true")
+		}
+	}
+
 	app.Command("login", "Login action", tokens.Create)
+	app.Command("lock", "Forget the passphrase of encrypted tokens for this session", tokens.Lock)
 
 	app.Command("accounts", "Account actions", func(act *cli.Cmd) {
 		act.Command("create", "Create an account ", accounts.Create)
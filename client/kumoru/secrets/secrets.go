@@ -17,6 +17,7 @@ limitations under the License.
 package secrets
 
 import (
+	"context"
 	"fmt"
 
 	log "github.com/Sirupsen/logrus"
@@ -24,6 +25,7 @@ import (
 	"github.com/fatih/structs"
 	"github.com/jawher/mow.cli"
 	"github.com/kumoru/kumoru-sdk-go/client/kumoru/utils"
+	"github.com/kumoru/kumoru-sdk-go/pkg/kumoru"
 	"github.com/kumoru/kumoru-sdk-go/pkg/service/authorization/secrets"
 	"github.com/ryanuber/columnize"
 )
@@ -53,6 +55,10 @@ func Create(cmd *cli.Cmd) {
 			log.Fatalf("Could not create secret: %s", errs[0])
 		}
 
+		if kumoru.IsDryRun(resp) {
+			return
+		}
+
 		if resp.StatusCode != 201 {
 			log.Fatalf("Could not create secret: %s", resp.Status)
 		}
@@ -62,18 +68,21 @@ func Create(cmd *cli.Cmd) {
 }
 
 func List(cmd *cli.Cmd) {
+	pages := utils.PageFlags(cmd, "secrets")
+
 	cmd.Action = func() {
-		secrets, resp, errs := secrets.List()
+		var s []*secrets.Secret
 
-		if len(errs) > 0 {
-			log.Fatalf("Could not retrieve secret: %s", errs[0])
+		it := secrets.NewService(kumoru.New()).Iterate(pages())
+		for it.Next(context.Background()) {
+			s = append(s, it.Secret())
 		}
 
-		if resp.StatusCode != 200 {
-			log.Fatalf("Could not retrieve secret: %s", resp.Status)
+		if err := it.Err(); err != nil {
+			log.Fatalf("Could not retrieve secret: %s", err)
 		}
 
-		printSecretBrief(secrets)
+		printSecretBrief(s)
 	}
 }
 
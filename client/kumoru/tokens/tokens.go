@@ -18,6 +18,8 @@ package tokens
 
 import (
 	"bufio"
+	"bytes"
+	"errors"
 	"fmt"
 	"os"
 	"strings"
@@ -43,21 +45,36 @@ func Create(cmd *cli.Cmd) {
 		Value:     false,
 		HideValue: true,
 	})
+	encrypt := cmd.Bool(cli.BoolOpt{
+		Name:      "e encrypt",
+		Desc:      "Encrypt the private token with a passphrase",
+		Value:     false,
+		HideValue: true,
+	})
 
 	cmd.Action = func() {
 		usrHome := os.Getenv("HOME")
 		directory := usrHome + "/.kumoru/"
 		filename := "config"
 		kfile := directory + filename
+		profile := kumoru.ActiveProfile()
 
 		if *dontSave == false {
-			if kumoru.HasTokens(kfile, "tokens") == true && *force == false {
+			if kumoru.HasTokens(kfile, kumoru.ProfileSection(profile, "tokens")) == true && *force == false {
 				fmt.Println(kfile, "configuration file already exists, or tokens already exist.")
 				fmt.Println("Please see help for additonal options.")
 				os.Exit(1)
 			}
 		}
 
+		var passphrase []byte
+		if *encrypt && *dontSave == false {
+			var errs error
+			if passphrase, errs = Passphrase(kfile, true); errs != nil {
+				log.Fatalf("Could not read passphrase: %s", errs)
+			}
+		}
+
 		username, password := credentials()
 		token, resp, body, errs := authorization.GetTokens(username, password)
 
@@ -65,6 +82,10 @@ func Create(cmd *cli.Cmd) {
 			log.Fatalf("Could not retrieve new tokens: %s", errs)
 		}
 
+		if kumoru.IsDryRun(resp) {
+			return
+		}
+
 		if resp.StatusCode != 201 {
 			log.Fatalf("Could not retrieve tokens: %s", resp.Status)
 			os.Exit(1)
@@ -72,16 +93,23 @@ func Create(cmd *cli.Cmd) {
 
 		switch *dontSave {
 		default:
-			errs := kumoru.SaveTokens(directory, filename, "tokens", kumoru.Ktokens{
+			tokens := kumoru.Ktokens{
 				Public:  token,
 				Private: body,
-			})
+			}
+
+			var errs error
+			if *encrypt {
+				errs = kumoru.SaveEncryptedTokens(directory, filename, kumoru.ProfileSection(profile, "tokens"), tokens, passphrase)
+			} else {
+				errs = kumoru.SaveTokens(directory, filename, kumoru.ProfileSection(profile, "tokens"), tokens)
+			}
 
 			if errs != nil {
 				log.Fatalf("Could not save tokens to file: %s", errs)
 			}
 		case true:
-			fmt.Printf("\n[tokens]\n")
+			fmt.Printf("\n[%s]\n", kumoru.ProfileSection(profile, "tokens"))
 			fmt.Printf("kumoru_token_public=%s\n", token)
 			fmt.Printf("kumoru_token_private=%s\n", body)
 		}
@@ -98,7 +126,7 @@ func Create(cmd *cli.Cmd) {
 
 		switch *dontSave {
 		default:
-			errs := kumoru.SaveRole(directory, filename, "auth", account.RoleUUID)
+			errs := kumoru.SaveRole(directory, filename, kumoru.ProfileSection(profile, "auth"), account.RoleUUID)
 
 			if errs != nil {
 				log.Fatalf("Could not save Role to file: %s", errs)
@@ -106,8 +134,13 @@ func Create(cmd *cli.Cmd) {
 
 			fmt.Printf("\nTokens saved to %s\n", kfile)
 		case true:
-			fmt.Printf("\n[auth]\n")
-			fmt.Printf("active_role=%s\n", account.RoleUUID)
+			// A named profile keeps its tokens and role in one section, whose header is already printed.
+			if kumoru.ProfileSection(profile, "auth") != kumoru.ProfileSection(profile, "tokens") {
+				fmt.Printf("\n[%s]\n", kumoru.ProfileSection(profile, "auth"))
+				fmt.Printf("active_role=%s\n", account.RoleUUID)
+			} else {
+				fmt.Printf("role_uuid=%s\n", account.RoleUUID)
+			}
 		}
 
 	}
@@ -134,3 +167,46 @@ func credentials() (string, string) {
 
 	return strings.TrimSpace(username), strings.TrimSpace(string(bytePassword))
 }
+
+// Passphrase prompts for the passphrase of an encrypted token store, unless KUMORU_PASSPHRASE is set.
+// It is used as kumoru.PassphraseFunc by the CLI.
+func Passphrase(store string, confirm bool) ([]byte, error) {
+	if p := os.Getenv("KUMORU_PASSPHRASE"); p != "" {
+		return []byte(p), nil
+	}
+
+	fmt.Fprintf(os.Stderr, "Enter passphrase for %s: ", store)
+	passphrase, err := terminal.ReadPassword(0)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(passphrase) == 0 {
+		return nil, errors.New("passphrase is empty")
+	}
+
+	if confirm {
+		fmt.Fprint(os.Stderr, "Confirm passphrase: ")
+		again, err := terminal.ReadPassword(0)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return nil, err
+		}
+
+		if !bytes.Equal(passphrase, again) {
+			return nil, errors.New("passphrases do not match")
+		}
+	}
+
+	return passphrase, nil
+}
+
+// Lock forgets passphrases cached for the session
+func Lock(cmd *cli.Cmd) {
+	cmd.Action = func() {
+		if err := kumoru.ForgetSession(); err != nil {
+			log.Fatalf("Could not remove cached keys: %s", err)
+		}
+	}
+}
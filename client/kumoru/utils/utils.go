@@ -19,6 +19,9 @@ package utils
 import (
 	"fmt"
 	"time"
+
+	"github.com/jawher/mow.cli"
+	"github.com/kumoru/kumoru-sdk-go/pkg/kumoru"
 )
 
 func FormatTime(t string) string {
@@ -27,3 +30,23 @@ func FormatTime(t string) string {
 
 	return fmt.Sprintf(parsedTime.In(time.Local).Format(time.RFC1123))
 }
+
+// PageFlags adds the --limit and --page-size options of a list command to cmd.
+// The returned function reads them once the command line has been parsed.
+func PageFlags(cmd *cli.Cmd, what string) func() kumoru.PageOptions {
+	limit := cmd.Int(cli.IntOpt{
+		Name:      "limit",
+		Desc:      fmt.Sprintf("Show at most this many %s (0 shows all)", what),
+		HideValue: true,
+	})
+
+	pageSize := cmd.Int(cli.IntOpt{
+		Name:      "page-size",
+		Desc:      fmt.Sprintf("Number of %s to fetch per request (0 lets the server decide)", what),
+		HideValue: true,
+	})
+
+	return func() kumoru.PageOptions {
+		return kumoru.PageOptions{Limit: *limit, PageSize: *pageSize}
+	}
+}
@@ -17,9 +17,7 @@ limitations under the License.
 package kumoru
 
 import (
-	"bytes"
 	"net/http"
-	"strings"
 )
 
 // NewRequest sets the appropriate header and appropriate request content
@@ -27,23 +25,23 @@ func (k *Client) NewRequest() (*http.Request, error) {
 	switch k.Method {
 	case POST, PUT, PATCH:
 		if k.TargetType == "json" {
-			req, err := http.NewRequest(k.Method, k.URL, strings.NewReader(k.RawString))
+			req, err := http.NewRequest(k.Method, k.URL, k.content())
 			req.Header.Set("Content-Type", "application/json")
 			return req, err
 		} else if k.TargetType == "json-patch+json" {
-			req, err := http.NewRequest(k.Method, k.URL, strings.NewReader(k.RawString))
+			req, err := http.NewRequest(k.Method, k.URL, k.content())
 			req.Header.Set("Content-Type", "application/json-patch+json")
 			return req, err
 		} else if k.TargetType == "form" {
-			req, err := http.NewRequest(k.Method, k.URL, bytes.NewBufferString(k.RawString))
+			req, err := http.NewRequest(k.Method, k.URL, k.content())
 			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 			return req, err
 		} else if k.TargetType == "text" {
-			req, err := http.NewRequest(k.Method, k.URL, strings.NewReader(k.RawString))
+			req, err := http.NewRequest(k.Method, k.URL, k.content())
 			req.Header.Set("Content-Type", "text/plain")
 			return req, err
 		} else if k.TargetType == "xml" {
-			req, err := http.NewRequest(k.Method, k.URL, strings.NewReader(k.RawString))
+			req, err := http.NewRequest(k.Method, k.URL, k.content())
 			req.Header.Set("Content-Type", "application/xml")
 			return req, err
 		}
@@ -0,0 +1,322 @@
+/*
+Copyright 2016 Kumoru.io
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package cassette records the requests a kumoru.Client makes, and the responses to them, to a file and replays
+// them in later runs, so that tests of code built on the SDK need not reach the Kumoru API:
+//
+// r, err := cassette.New("testdata/deploy.json", cassette.ModeFromEnvironment(), nil)
+// …
+// defer r.Stop()
+//
+// k, err := kumoru.NewClient(kumoru.WithTransport(r))
+//
+// Headers, URLs and bodies are scrubbed with a kumoru.Redactor before they are written, so credentials, tokens
+// and secret values never reach the cassette. Requests are replayed by method, path, query and body, compared
+// after scrubbing; headers, including the signature and X-Kumoru-Date, are not compared.
+package cassette
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/kumoru/kumoru-sdk-go/pkg/kumoru"
+)
+
+// Mode selects whether a Recorder talks to the API or to its cassette
+type Mode int
+
+const (
+	// ModeReplay answers requests from the cassette and fails those it has no recording of.
+	ModeReplay Mode = iota
+	// ModeRecord sends requests to the API and overwrites the cassette with them on Stop.
+	ModeRecord
+)
+
+// ModeFromEnvironment returns ModeRecord when KUMORU_CASSETTE is "record" and ModeReplay otherwise
+func ModeFromEnvironment() Mode {
+	if strings.ToLower(os.Getenv("KUMORU_CASSETTE")) == "record" {
+		return ModeRecord
+	}
+	return ModeReplay
+}
+
+// Cassette is the stored list of interactions
+type Cassette struct {
+	Interactions []*Interaction `json:"interactions"`
+}
+
+// Interaction is one recorded request and its response
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+// Request is a scrubbed recorded request
+type Request struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body,omitempty"`
+}
+
+// Response is a scrubbed recorded response
+type Response struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body,omitempty"`
+}
+
+// Load reads the cassette stored at path
+func Load(path string) (*Cassette, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Cassette{}
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, fmt.Errorf("cassette: %s: %v", path, err)
+	}
+
+	return c, nil
+}
+
+// Save writes c to path, creating its directory if needed
+func (c *Cassette) Save(path string) error {
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, append(b, '\n'), 0644)
+}
+
+// MismatchError is returned for a request replayed without a matching recorded interaction
+type MismatchError struct {
+	Request Request
+}
+
+func (e *MismatchError) Error() string {
+	s := fmt.Sprintf("cassette: no recorded interaction matches %s %s", e.Request.Method, e.Request.URL)
+	if e.Request.Body != "" {
+		s += fmt.Sprintf(" with body %q", e.Request.Body)
+	}
+	return s
+}
+
+// Recorder is an http.RoundTripper which records to, or replays from, the cassette at Path
+type Recorder struct {
+	Path string
+	Mode Mode
+	// Redactor scrubs what is recorded; it defaults to kumoru.DefaultRedactor.
+	Redactor *kumoru.Redactor
+	// Transport sends requests while recording.
+	Transport http.RoundTripper
+
+	mu         sync.Mutex
+	cassette   *Cassette
+	used       []bool
+	mismatches []error
+}
+
+// New returns a Recorder for the cassette at path. In ModeReplay the cassette must exist.
+// A nil transport records through kumoru.DefaultTransport.
+func New(path string, mode Mode, transport http.RoundTripper) (*Recorder, error) {
+	if transport == nil {
+		transport = kumoru.DefaultTransport()
+	}
+
+	r := &Recorder{
+		Path:      path,
+		Mode:      mode,
+		Redactor:  kumoru.DefaultRedactor(),
+		Transport: transport,
+		cassette:  &Cassette{},
+	}
+
+	if mode == ModeReplay {
+		c, err := Load(path)
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("cassette: %s does not exist; record it with KUMORU_CASSETTE=record", path)
+		} else if err != nil {
+			return nil, err
+		}
+		r.cassette = c
+		r.used = make([]bool, len(c.Interactions))
+	}
+
+	return r, nil
+}
+
+// RoundTrip records or replays req
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	recorded := r.request(req, body)
+
+	if r.Mode == ModeRecord {
+		return r.record(req, recorded)
+	}
+	return r.replay(req, recorded)
+}
+
+// Stop saves the cassette when recording. When replaying it reports requests which had no recording,
+// in case the code under test swallowed the error RoundTrip returned for them.
+func (r *Recorder) Stop() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.Mode == ModeRecord {
+		return r.cassette.Save(r.Path)
+	}
+
+	if len(r.mismatches) > 0 {
+		return fmt.Errorf("%v (and %d more unmatched requests)", r.mismatches[0], len(r.mismatches)-1)
+	}
+
+	return nil
+}
+
+func (r *Recorder) record(req *http.Request, recorded Request) (*http.Response, error) {
+	resp, err := r.Transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	response := Response{
+		Status: resp.StatusCode,
+		Header: r.redactor().Header(resp.Header),
+		Body:   r.redactor().Body(resp.Header.Get("Content-Type"), body),
+	}
+	if len(body) > 0 && r.redactor().HidesBody(req.URL) {
+		response.Body = kumoru.Redacted
+	}
+
+	r.mu.Lock()
+	r.cassette.Interactions = append(r.cassette.Interactions, &Interaction{Request: recorded, Response: response})
+	r.mu.Unlock()
+
+	return resp, nil
+}
+
+func (r *Recorder) replay(req *http.Request, recorded Request) (*http.Response, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, in := range r.cassette.Interactions {
+		if !r.used[i] && matches(in.Request, recorded) {
+			r.used[i] = true
+			return in.Response.http(req), nil
+		}
+	}
+
+	err := &MismatchError{Request: recorded}
+	r.mismatches = append(r.mismatches, err)
+	return nil, err
+}
+
+// request returns req, with body, scrubbed for recording and matching
+func (r *Recorder) request(req *http.Request, body []byte) Request {
+	return Request{
+		Method: req.Method,
+		URL:    r.redactor().URL(req.URL),
+		Header: r.redactor().Header(req.Header),
+		Body:   r.redactor().Body(req.Header.Get("Content-Type"), body),
+	}
+}
+
+func (r *Recorder) redactor() *kumoru.Redactor {
+	if r.Redactor != nil {
+		return r.Redactor
+	}
+	return kumoru.DefaultRedactor()
+}
+
+// matches reports whether a and b have the same method, path, query and body
+func matches(a, b Request) bool {
+	if a.Method != b.Method || a.Body != b.Body {
+		return false
+	}
+
+	ua, err := url.Parse(a.URL)
+	if err != nil {
+		return false
+	}
+	ub, err := url.Parse(b.URL)
+	if err != nil {
+		return false
+	}
+
+	return ua.Path == ub.Path && ua.Query().Encode() == ub.Query().Encode()
+}
+
+// http returns r as the response to req
+func (r Response) http(req *http.Request) *http.Response {
+	header := http.Header{}
+	for name, values := range r.Header {
+		header[name] = append([]string(nil), values...)
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", r.Status, http.StatusText(r.Status)),
+		StatusCode:    r.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(strings.NewReader(r.Body)),
+		ContentLength: int64(len(r.Body)),
+		Request:       req,
+	}
+}
+
+// readBody reads and replaces the body of req
+func readBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil {
+		return nil, nil
+	}
+
+	body, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	return body, nil
+}
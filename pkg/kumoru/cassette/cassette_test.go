@@ -0,0 +1,128 @@
+/*
+Copyright 2016 Kumoru.io
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cassette
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kumoru/kumoru-sdk-go/pkg/kumoru"
+	"github.com/stretchr/testify/assert"
+)
+
+func testClient(t *testing.T, url string, r *Recorder, opts ...kumoru.Option) *kumoru.Client {
+	opts = append([]kumoru.Option{
+		kumoru.WithEndpoints(kumoru.Endpoints{Application: url, Authorization: url, Location: url}),
+		kumoru.WithCredentials("PUBLIC_TOKEN", "PRIVATE_TOKEN"),
+		kumoru.WithRole("ROLE_UUID"),
+		kumoru.WithTransport(r),
+	}, opts...)
+
+	k, err := kumoru.NewClient(opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func createSecret(k *kumoru.Client, url, value string) (*http.Response, string, []error) {
+	k.Post(url + "/v1/secrets/")
+	k.SignRequest(true)
+	k.Send("value=" + value + "&labels=db")
+	return k.End()
+}
+
+func TestRecordReplay(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"uuid":"1234","value":"s3cr3t"}`))
+	}))
+
+	dir, err := ioutil.TempDir("", "cassette")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "secrets.json")
+
+	rec, err := New(path, ModeRecord, nil)
+	assert.Nil(t, err)
+
+	resp, body, errs := createSecret(testClient(t, ts.URL, rec), ts.URL, "s3cr3t")
+	assert.Nil(t, errs)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Contains(t, body, "s3cr3t", "recording passes the real response through")
+	assert.Nil(t, rec.Stop())
+	ts.Close()
+
+	saved, err := ioutil.ReadFile(path)
+	assert.Nil(t, err)
+	assert.NotContains(t, string(saved), "s3cr3t")
+	assert.NotContains(t, string(saved), "PUBLIC_TOKEN:")
+	assert.Contains(t, string(saved), kumoru.Redacted)
+
+	rec, err = New(path, ModeReplay, nil)
+	assert.Nil(t, err)
+
+	later := func() time.Time { return time.Now().Add(time.Hour) }
+	resp, body, errs = createSecret(testClient(t, ts.URL, rec, kumoru.WithClock(later)), ts.URL, "s3cr3t")
+	assert.Nil(t, errs)
+	if assert.NotNil(t, resp) {
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	}
+	assert.Contains(t, body, `"uuid":"1234"`)
+	assert.Nil(t, rec.Stop())
+
+	_, _, errs = createSecret(testClient(t, ts.URL, rec), ts.URL, "other")
+	assert.NotEmpty(t, errs, "each recording is replayed once")
+	assert.NotNil(t, rec.Stop())
+}
+
+func TestReplayMismatch(t *testing.T) {
+	rec := &Recorder{Mode: ModeReplay, cassette: &Cassette{Interactions: []*Interaction{{
+		Request:  Request{Method: "GET", URL: "https://application.example/v1/applications/?tag=b&tag=a"},
+		Response: Response{Status: http.StatusOK, Body: "[]"},
+	}}}, used: make([]bool, 1)}
+
+	req, _ := http.NewRequest("GET", "https://other.example/v1/applications/?tag=b&tag=c", nil)
+	_, err := rec.RoundTrip(req)
+	if assert.IsType(t, &MismatchError{}, err) {
+		assert.Contains(t, err.Error(), "GET https://other.example/v1/applications/")
+	}
+
+	req, _ = http.NewRequest("GET", "https://other.example/v1/applications/?tag=b&tag=a", nil)
+	resp, err := rec.RoundTrip(req)
+	if assert.Nil(t, err) {
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	assert.NotNil(t, rec.Stop())
+}
+
+func TestMissingCassette(t *testing.T) {
+	_, err := New(filepath.Join(os.TempDir(), "kumoru-missing-cassette.json"), ModeReplay, nil)
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "KUMORU_CASSETTE=record")
+	}
+}
@@ -0,0 +1,205 @@
+/*
+Copyright 2016 Kumoru.io
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kumoru
+
+import (
+	"crypto/tls"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/go-ini/ini"
+	"golang.org/x/crypto/pkcs12"
+)
+
+// ClientCertificate names the certificate and key a Client presents to gateways requiring mutual TLS.
+// Either CertFile and KeyFile, holding PEM, or PKCS12File is set.
+// The files are checked on every TLS handshake and read again when they change,
+// so a rotated certificate is used by the next connection made.
+type ClientCertificate struct {
+	CertFile       string
+	KeyFile        string
+	PKCS12File     string
+	PKCS12Password string
+}
+
+// IsZero reports whether no certificate is configured
+func (c ClientCertificate) IsZero() bool {
+	return c == ClientCertificate{}
+}
+
+// files returns the files c is read from
+func (c ClientCertificate) files() []string {
+	if c.PKCS12File != "" {
+		return []string{c.PKCS12File}
+	}
+	return []string{c.CertFile, c.KeyFile}
+}
+
+// Load reads the certificate and key
+func (c ClientCertificate) Load() (*tls.Certificate, error) {
+	var cert tls.Certificate
+	var err error
+
+	switch {
+	case c.PKCS12File != "":
+		cert, err = loadPKCS12(c.PKCS12File, c.PKCS12Password)
+	case c.CertFile != "" && c.KeyFile != "":
+		cert, err = tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	default:
+		return nil, fmt.Errorf("kumoru: a client certificate needs both a certificate and a key file")
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("kumoru: loading client certificate: %s", err)
+	}
+
+	return &cert, nil
+}
+
+// loadPKCS12 reads a PKCS#12 archive holding a key, its certificate and optionally the certificate's chain
+func loadPKCS12(filename, password string) (tls.Certificate, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	blocks, err := pkcs12.ToPEM(data, password)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	var certPEM, keyPEM []byte
+	for _, b := range blocks {
+		if b.Type == "CERTIFICATE" {
+			certPEM = append(certPEM, pem.EncodeToMemory(b)...)
+		} else {
+			keyPEM = append(keyPEM, pem.EncodeToMemory(b)...)
+		}
+	}
+
+	return tls.X509KeyPair(certPEM, keyPEM)
+}
+
+// stamp summarises the size and modification time of the files c is read from
+func (c ClientCertificate) stamp() (string, error) {
+	var s string
+
+	for _, name := range c.files() {
+		info, err := os.Stat(name)
+		if err != nil {
+			return "", err
+		}
+		s += fmt.Sprintf("%s:%d:%d;", name, info.Size(), info.ModTime().UnixNano())
+	}
+
+	return s, nil
+}
+
+// certificateReloader serves a ClientCertificate to tls.Config.GetClientCertificate,
+// reading it again whenever its files change
+type certificateReloader struct {
+	source ClientCertificate
+
+	mu    sync.Mutex
+	cert  *tls.Certificate
+	stamp string
+}
+
+// newCertificateReloader loads c, so that a missing or invalid certificate is reported at once
+func newCertificateReloader(c ClientCertificate) (*certificateReloader, error) {
+	r := &certificateReloader{source: c}
+	if _, err := r.GetClientCertificate(nil); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetClientCertificate implements tls.Config.GetClientCertificate.
+// While the files are being replaced and cannot be loaded, the previous certificate is kept.
+func (r *certificateReloader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stamp, err := r.source.stamp()
+	if err == nil && r.cert != nil && stamp == r.stamp {
+		return r.cert, nil
+	}
+
+	cert, err := r.source.Load()
+	if err != nil {
+		if r.cert != nil {
+			return r.cert, nil
+		}
+		return nil, err
+	}
+
+	r.cert, r.stamp = cert, stamp
+	return cert, nil
+}
+
+// ClientCertificateFromEnvironment returns the client certificate set by KUMORU_TLS_CLIENT_CERT and
+// KUMORU_TLS_CLIENT_KEY or KUMORU_TLS_CLIENT_PKCS12 and KUMORU_TLS_CLIENT_PKCS12_PASSWORD
+func ClientCertificateFromEnvironment() ClientCertificate {
+	return ClientCertificate{
+		CertFile:       os.Getenv("KUMORU_TLS_CLIENT_CERT"),
+		KeyFile:        os.Getenv("KUMORU_TLS_CLIENT_KEY"),
+		PKCS12File:     os.Getenv("KUMORU_TLS_CLIENT_PKCS12"),
+		PKCS12Password: os.Getenv("KUMORU_TLS_CLIENT_PKCS12_PASSWORD"),
+	}
+}
+
+// LoadClientCertificate reads the client_cert, client_key, client_pkcs12 and client_pkcs12_password
+// keys of the tls section of profile in filename
+func LoadClientCertificate(filename, profile string) ClientCertificate {
+	config, err := ini.Load(filename)
+	if err != nil {
+		return ClientCertificate{}
+	}
+
+	section := config.Section(ProfileSection(profile, "tls"))
+
+	return ClientCertificate{
+		CertFile:       section.Key("client_cert").String(),
+		KeyFile:        section.Key("client_key").String(),
+		PKCS12File:     section.Key("client_pkcs12").String(),
+		PKCS12Password: section.Key("client_pkcs12_password").String(),
+	}
+}
+
+// SetClientCertificate makes k present c to servers which request a client certificate
+func (k *Client) SetClientCertificate(c ClientCertificate) error {
+	r, err := newCertificateReloader(c)
+	if err != nil {
+		return err
+	}
+
+	config := k.tlsConfig().Clone()
+	config.GetClientCertificate = r.GetClientCertificate
+
+	k.Transport = newTransport(config, k.proxy())
+	return nil
+}
+
+// WithClientCertificate makes the Client present c to servers which request a client certificate
+func WithClientCertificate(c ClientCertificate) Option {
+	return func(k *Client) error {
+		return k.SetClientCertificate(c)
+	}
+}
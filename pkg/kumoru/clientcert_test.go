@@ -0,0 +1,188 @@
+/*
+Copyright 2016 Kumoru.io
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kumoru
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testCA issues client certificates for tests
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "kumoru-test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, _ := x509.ParseCertificate(der)
+	return &testCA{cert: cert, key: key}
+}
+
+// writeClientCertificate issues a certificate for commonName and writes it and its key as PEM into dir
+func (ca *testCA) writeClientCertificate(t *testing.T, dir, commonName string) ClientCertificate {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+
+	c := ClientCertificate{CertFile: filepath.Join(dir, "client.pem"), KeyFile: filepath.Join(dir, "client-key.pem")}
+	ioutil.WriteFile(c.CertFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	ioutil.WriteFile(c.KeyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	return c
+}
+
+// newMutualTLSServer returns a server requiring certificates issued by ca, which responds with the client's common name
+func newMutualTLSServer(ca *testCA) *httptest.Server {
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	ts.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: pool}
+	ts.StartTLS()
+	return ts
+}
+
+func clientCommonName(k *Client, url string) (string, []error) {
+	k.Get(url + "/v1/applications/")
+	_, body, errs := k.End()
+	return body, errs
+}
+
+func TestClientCertificate(t *testing.T) {
+	ca := newTestCA(t)
+	ts := newMutualTLSServer(ca)
+	defer ts.Close()
+
+	bundle := writeBundle(t, ts)
+	dir := filepath.Dir(bundle)
+	defer os.RemoveAll(dir)
+
+	k, _ := NewClient(WithoutCredentials(), WithTrust(TrustConfig{CABundle: bundle}))
+	_, errs := clientCommonName(k, ts.URL)
+	assert.NotNil(t, errs, "the gateway requires a certificate")
+
+	cert := ca.writeClientCertificate(t, dir, "client-1")
+	k, err := NewClient(WithoutCredentials(), WithTrust(TrustConfig{CABundle: bundle, ClientCertificate: cert}))
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	name, errs := clientCommonName(k, ts.URL)
+	assert.Nil(t, errs)
+	assert.Equal(t, "client-1", name)
+
+	ca.writeClientCertificate(t, dir, "client-2")
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(cert.CertFile, later, later)
+	k.Transport.CloseIdleConnections()
+
+	name, errs = clientCommonName(k, ts.URL)
+	assert.Nil(t, errs)
+	assert.Equal(t, "client-2", name, "a rotated certificate is picked up by new connections")
+
+	ioutil.WriteFile(cert.CertFile, []byte("rotating"), 0600)
+	k.Transport.CloseIdleConnections()
+
+	name, errs = clientCommonName(k, ts.URL)
+	assert.Nil(t, errs)
+	assert.Equal(t, "client-2", name, "the previous certificate is kept while the files are incomplete")
+
+	_, err = NewClient(WithoutCredentials(), WithClientCertificate(ClientCertificate{CertFile: cert.CertFile}))
+	assert.NotNil(t, err, "a certificate without a key is an error")
+}
+
+func TestClientCertificatePKCS12(t *testing.T) {
+	c := ClientCertificate{PKCS12File: "testdata/client.p12", PKCS12Password: "kumoru"}
+
+	cert, err := c.Load()
+	if assert.Nil(t, err) {
+		leaf, _ := x509.ParseCertificate(cert.Certificate[0])
+		assert.Equal(t, "kumoru-test-client", leaf.Subject.CommonName)
+	}
+
+	c.PKCS12Password = "wrong"
+	_, err = c.Load()
+	assert.NotNil(t, err)
+}
+
+func TestClientCertificateFromConfig(t *testing.T) {
+	dir := testConfigDir(t)
+	defer os.RemoveAll(dir)
+
+	config := "[profile gateway]\nclient_cert=gateway.pem\nclient_key=gateway-key.pem\n"
+	ioutil.WriteFile(dir+"/config", []byte(config), 0600)
+
+	assert.Equal(t, ClientCertificate{CertFile: "gateway.pem", KeyFile: "gateway-key.pem"}, LoadClientCertificate(dir+"/config", "gateway"))
+	assert.True(t, LoadClientCertificate(dir+"/config", DefaultProfile).IsZero())
+
+	_, err := NewClient(WithProfile(dir+"/config", "gateway"))
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "client certificate", "a missing certificate is reported")
+	}
+
+	os.Clearenv()
+	defer os.Clearenv()
+
+	assert.True(t, ClientCertificateFromEnvironment().IsZero())
+
+	os.Setenv("KUMORU_TLS_CLIENT_PKCS12", "client.p12")
+	assert.Equal(t, "client.p12", TrustFromEnvironment().ClientCertificate.PKCS12File)
+}
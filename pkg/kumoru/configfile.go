@@ -0,0 +1,193 @@
+/*
+Copyright 2016 Kumoru.io
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kumoru
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/go-ini/ini"
+)
+
+const (
+	// ConfigFileMode and ConfigDirMode are the permissions given to the config file and its directory.
+	ConfigFileMode os.FileMode = 0600
+	ConfigDirMode  os.FileMode = 0700
+)
+
+var (
+	// lockTimeout is how long to wait for another process to release the config file.
+	lockTimeout = 10 * time.Second
+	// staleLockAge is the age after which a lock left by a crashed process is removed.
+	staleLockAge = 30 * time.Second
+)
+
+// updateConfig loads the ini file at directory+filename, applies update and replaces the file
+// atomically while holding an advisory lock, so that concurrent writers do not lose each other's changes.
+func updateConfig(directory, filename string, update func(*ini.File)) error {
+	kfile := directory + filename
+
+	_, statErr := os.Stat(directory)
+	created := os.IsNotExist(statErr)
+
+	if err := os.MkdirAll(directory, ConfigDirMode); err != nil {
+		return err
+	}
+
+	// MkdirAll leaves an existing directory as it is. Only the SDK's own directory, which an older
+	// release created with looser permissions, is narrowed; the caller's other directories are not ours to change.
+	if info, err := os.Stat(directory); err == nil && info.Mode().Perm()&^ConfigDirMode != 0 && runtime.GOOS != "windows" {
+		if created || isConfigDir(directory) {
+			if err := os.Chmod(directory, ConfigDirMode); err != nil {
+				return err
+			}
+		} else {
+			log.Warningf("kumoru: %s can be read by other users (mode %#o)", directory, info.Mode().Perm())
+		}
+	}
+
+	unlock, err := lockConfig(kfile)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	config := ini.Empty()
+	if _, err := os.Stat(kfile); err == nil {
+		if config, err = ini.Load(kfile); err != nil {
+			return fmt.Errorf("kumoru: reading %s: %s", kfile, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	update(config)
+
+	return writeConfig(directory, kfile, config)
+}
+
+// isConfigDir reports whether directory is $HOME/.kumoru, where the SDK keeps its config file
+func isConfigDir(directory string) bool {
+	home := os.Getenv("HOME")
+	return home != "" && filepath.Clean(directory) == filepath.Join(home, ".kumoru")
+}
+
+// writeConfig writes config to a temporary file in directory and renames it over kfile
+func writeConfig(directory, kfile string, config *ini.File) error {
+	tmp, err := ioutil.TempFile(directory, ".config-")
+	if err != nil {
+		return err
+	}
+
+	if err := tmp.Chmod(ConfigFileMode); err != nil && runtime.GOOS != "windows" {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	_, err = config.WriteTo(tmp)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), kfile)
+	}
+
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("kumoru: writing %s: %s", kfile, err)
+	}
+
+	return nil
+}
+
+// lockConfig takes an advisory lock on kfile by exclusively creating kfile.lock.
+// A lock older than staleLockAge is assumed to belong to a crashed process and is removed.
+func lockConfig(kfile string) (func(), error) {
+	lockfile := kfile + ".lock"
+	deadline := time.Now().Add(lockTimeout)
+
+	for {
+		f, err := os.OpenFile(lockfile, os.O_WRONLY|os.O_CREATE|os.O_EXCL, ConfigFileMode)
+		if err == nil {
+			f.WriteString(strconv.Itoa(os.Getpid()))
+			f.Close()
+			return func() { os.Remove(lockfile) }, nil
+		}
+
+		if !os.IsExist(err) {
+			return nil, err
+		}
+
+		if info, statErr := os.Stat(lockfile); statErr == nil && time.Since(info.ModTime()) > staleLockAge {
+			removeStaleLock(lockfile, info)
+			continue
+		}
+
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("kumoru: %s is locked by another process; remove %s if it is stale", kfile, lockfile)
+		}
+
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// removeStaleLock removes lockfile if it is still the lock described by stale. The lock is renamed aside
+// before it is checked, so that a lock another process took after stale was read is put back, not removed.
+func removeStaleLock(lockfile string, stale os.FileInfo) {
+	aside := fmt.Sprintf("%s.%d.stale", lockfile, os.Getpid())
+	if err := os.Rename(lockfile, aside); err != nil {
+		return
+	}
+
+	if info, err := os.Stat(aside); err == nil && os.SameFile(info, stale) && info.ModTime().Equal(stale.ModTime()) {
+		os.Remove(aside)
+		return
+	}
+
+	// Link fails rather than replace a lock taken since the rename.
+	os.Link(aside, lockfile)
+	os.Remove(aside)
+}
+
+// CheckConfigPermissions returns an error if filename can be read or written by users other than its owner.
+// A missing file is not an error.
+func CheckConfigPermissions(filename string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+
+	info, err := os.Stat(filename)
+	if err != nil {
+		return nil
+	}
+
+	if mode := info.Mode().Perm(); mode&0077 != 0 {
+		return fmt.Errorf("%s holds private tokens but has mode %04o; run chmod 600 %s", filename, mode, filename)
+	}
+
+	return nil
+}
@@ -0,0 +1,139 @@
+/*
+Copyright 2016 Kumoru.io
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kumoru
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testConfigDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "kumoru")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestSaveTokensPermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("permission bits are not meaningful on windows")
+	}
+
+	dir := testConfigDir(t)
+	defer os.RemoveAll(dir)
+
+	directory := dir + "/.kumoru/"
+	assert.Nil(t, SaveTokens(directory, "config", "tokens", Ktokens{Public: "PUBLIC", Private: "PRIVATE"}))
+
+	info, err := os.Stat(directory)
+	if assert.Nil(t, err) {
+		assert.Equal(t, ConfigDirMode, info.Mode().Perm())
+	}
+
+	info, err = os.Stat(directory + "config")
+	if assert.Nil(t, err) {
+		assert.Equal(t, ConfigFileMode, info.Mode().Perm())
+	}
+	assert.Nil(t, CheckConfigPermissions(directory+"config"))
+
+	os.Chmod(directory+"config", 0644)
+	assert.NotNil(t, CheckConfigPermissions(directory+"config"))
+
+	defer os.Setenv("HOME", os.Getenv("HOME"))
+	os.Setenv("HOME", dir)
+	os.Chmod(directory, 0755)
+	assert.Nil(t, SaveRole(directory, "config", "auth", "ROLE"))
+	assert.Nil(t, CheckConfigPermissions(directory+"config"), "rewriting the file restores its mode")
+
+	info, err = os.Stat(directory)
+	if assert.Nil(t, err) {
+		assert.Equal(t, ConfigDirMode, info.Mode().Perm(), "an existing ~/.kumoru is narrowed")
+	}
+
+	os.Chmod(dir, 0755)
+	assert.Nil(t, SaveRole(dir+"/", "config", "auth", "ROLE"))
+	info, err = os.Stat(dir)
+	if assert.Nil(t, err) {
+		assert.Equal(t, os.FileMode(0755), info.Mode().Perm(), "other existing directories are left alone")
+	}
+
+	tokens, _ := LoadTokens(directory+"config", "tokens")
+	assert.Equal(t, "PRIVATE", tokens.Private, "existing sections are kept")
+
+	_, err = os.Stat(directory + "config.lock")
+	assert.True(t, os.IsNotExist(err), "the lock is released")
+}
+
+func TestSaveTokensConcurrently(t *testing.T) {
+	dir := testConfigDir(t)
+	defer os.RemoveAll(dir)
+	dir += "/"
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			profile := fmt.Sprintf("p%d", i)
+			if err := SaveTokens(dir, "config", ProfileSection(profile, "tokens"), Ktokens{Public: profile, Private: profile}); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < 10; i++ {
+		profile := fmt.Sprintf("p%d", i)
+		tokens, err := LoadTokens(dir+"config", ProfileSection(profile, "tokens"))
+		assert.Nil(t, err)
+		assert.Equal(t, profile, tokens.Public)
+	}
+}
+
+func TestConfigLock(t *testing.T) {
+	dir := testConfigDir(t)
+	defer os.RemoveAll(dir)
+	dir += "/"
+
+	defer func(timeout time.Duration) { lockTimeout = timeout }(lockTimeout)
+	lockTimeout = 100 * time.Millisecond
+
+	ioutil.WriteFile(dir+"config.lock", []byte("1"), 0600)
+	assert.NotNil(t, SaveRole(dir, "config", "auth", "ROLE"), "a held lock times out")
+
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(dir+"config.lock", old, old)
+	assert.Nil(t, SaveRole(dir, "config", "auth", "ROLE"), "a stale lock is removed")
+
+	ioutil.WriteFile(dir+"config.lock", []byte("1"), 0600)
+	os.Chtimes(dir+"config.lock", old, old)
+	stale, _ := os.Stat(dir + "config.lock")
+	os.Remove(dir + "config.lock")
+	ioutil.WriteFile(dir+"config.lock", []byte("2"), 0600)
+
+	removeStaleLock(dir+"config.lock", stale)
+	held, _ := ioutil.ReadFile(dir + "config.lock")
+	assert.Equal(t, "2", string(held), "a lock taken after the stale one was seen is kept")
+}
@@ -0,0 +1,262 @@
+/*
+Copyright 2016 Kumoru.io
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kumoru
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-ini/ini"
+)
+
+// ErrNoCredentials is returned by a CredentialProvider which has no tokens to offer
+var ErrNoCredentials = errors.New("kumoru: no credentials found")
+
+// Credentials are the tokens and role used to sign requests
+type Credentials struct {
+	Public   string `json:"public_token"`
+	Private  string `json:"private_token"`
+	RoleUUID string `json:"role_uuid"`
+}
+
+func (c Credentials) hasTokens() bool {
+	return c.Public != "" && c.Private != ""
+}
+
+// CredentialProvider supplies Credentials. A provider with nothing to offer returns ErrNoCredentials.
+type CredentialProvider interface {
+	Credentials() (Credentials, error)
+}
+
+// StaticCredentials provides fixed credentials
+type StaticCredentials Credentials
+
+// Credentials implements CredentialProvider
+func (s StaticCredentials) Credentials() (Credentials, error) {
+	c := Credentials(s)
+	if !c.hasTokens() && c.RoleUUID == "" {
+		return c, ErrNoCredentials
+	}
+	return c, nil
+}
+
+// EnvCredentials reads KUMORU_TOKEN_PUBLIC, KUMORU_TOKEN_PRIVATE and KUMORU_ROLE_UUID
+type EnvCredentials struct{}
+
+// Credentials implements CredentialProvider
+func (EnvCredentials) Credentials() (Credentials, error) {
+	return StaticCredentials{
+		Public:   os.Getenv("KUMORU_TOKEN_PUBLIC"),
+		Private:  os.Getenv("KUMORU_TOKEN_PRIVATE"),
+		RoleUUID: os.Getenv("KUMORU_ROLE_UUID"),
+	}.Credentials()
+}
+
+// FileCredentials reads a profile of a config file in the format of $HOME/.kumoru/config
+type FileCredentials struct {
+	Filename string
+	Profile  string
+}
+
+// Credentials implements CredentialProvider
+func (f FileCredentials) Credentials() (Credentials, error) {
+	roleUUID, _ := LoadRole(f.Filename, ProfileSection(f.Profile, "auth"))
+
+	if !HasTokens(f.Filename, ProfileSection(f.Profile, "tokens")) {
+		return StaticCredentials{RoleUUID: roleUUID}.Credentials()
+	}
+
+	t, err := LoadTokens(f.Filename, ProfileSection(f.Profile, "tokens"))
+	if err != nil {
+		return Credentials{}, err
+	}
+
+	return StaticCredentials{Public: t.Public, Private: t.Private, RoleUUID: roleUUID}.Credentials()
+}
+
+// HelperTimeout bounds how long a credential helper may run
+var HelperTimeout = 30 * time.Second
+
+// HelperCredentials runs an external program to obtain credentials, so that they need not be stored on disk.
+//
+// The program is run as "Command get" with KUMORU_PROFILE set to Profile and must print a JSON object to stdout:
+//
+// {"public_token": "...", "private_token": "...", "role_uuid": "...", "expires_at": "2016-07-11T14:42:53Z"}
+//
+// role_uuid and expires_at are optional. Results are cached in the process until they expire.
+type HelperCredentials struct {
+	Command string
+	Profile string
+}
+
+type helperResponse struct {
+	Credentials
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// helperCall is a run of a credential helper which other callers of the same helper wait for
+type helperCall struct {
+	done chan struct{}
+	r    helperResponse
+	err  error
+}
+
+var helperCache = struct {
+	sync.Mutex
+	entries  map[HelperCredentials]helperResponse
+	inflight map[HelperCredentials]*helperCall
+}{
+	entries:  make(map[HelperCredentials]helperResponse),
+	inflight: make(map[HelperCredentials]*helperCall),
+}
+
+// Credentials implements CredentialProvider
+func (h HelperCredentials) Credentials() (Credentials, error) {
+	args := strings.Fields(h.Command)
+	if len(args) == 0 {
+		return Credentials{}, ErrNoCredentials
+	}
+
+	helperCache.Lock()
+	if r, ok := helperCache.entries[h]; ok && (r.ExpiresAt.IsZero() || time.Now().Before(r.ExpiresAt)) {
+		helperCache.Unlock()
+		return r.Credentials, nil
+	}
+
+	// The lock is not held while the helper runs; concurrent callers of the same helper share one run.
+	call, running := helperCache.inflight[h]
+	if !running {
+		call = &helperCall{done: make(chan struct{})}
+		helperCache.inflight[h] = call
+	}
+	helperCache.Unlock()
+
+	if running {
+		<-call.done
+		return call.r.Credentials, call.err
+	}
+
+	call.r, call.err = h.run(args)
+
+	helperCache.Lock()
+	if call.err == nil {
+		helperCache.entries[h] = call.r
+	}
+	delete(helperCache.inflight, h)
+	helperCache.Unlock()
+	close(call.done)
+
+	return call.r.Credentials, call.err
+}
+
+// run executes the helper named by args and decodes its response
+func (h HelperCredentials) run(args []string) (helperResponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), HelperTimeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, args[0], append(args[1:], "get")...)
+	cmd.Env = append(os.Environ(), "KUMORU_PROFILE="+h.Profile)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return helperResponse{}, fmt.Errorf("kumoru: credential helper %s: %s: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+
+	var r helperResponse
+	if err := json.Unmarshal(stdout.Bytes(), &r); err != nil {
+		return helperResponse{}, fmt.Errorf("kumoru: credential helper %s: %s", args[0], err)
+	}
+
+	if !r.hasTokens() {
+		return helperResponse{}, fmt.Errorf("kumoru: credential helper %s returned no tokens", args[0])
+	}
+
+	return r, nil
+}
+
+// CredentialChain asks each provider in turn until one supplies tokens.
+// The role is taken from the first provider consulted which supplies one, so that
+// e.g. KUMORU_ROLE_UUID can select a role for tokens from the config file.
+type CredentialChain []CredentialProvider
+
+// Credentials implements CredentialProvider
+func (chain CredentialChain) Credentials() (Credentials, error) {
+	var roleUUID string
+
+	for _, p := range chain {
+		c, err := p.Credentials()
+		if err != nil && err != ErrNoCredentials {
+			return Credentials{}, err
+		}
+
+		if roleUUID == "" {
+			roleUUID = c.RoleUUID
+		}
+
+		if c.hasTokens() {
+			c.RoleUUID = roleUUID
+			return c, nil
+		}
+	}
+
+	return Credentials{RoleUUID: roleUUID}, ErrNoCredentials
+}
+
+// DefaultCredentials returns the chain used by New: the environment, then profile in filename, then
+// the credential helper named by KUMORU_CREDENTIAL_HELPER or the profile's credential_helper key.
+func DefaultCredentials(filename, profile string) CredentialChain {
+	helper := os.Getenv("KUMORU_CREDENTIAL_HELPER")
+	if helper == "" {
+		if config, err := ini.Load(filename); err == nil {
+			if section, err := config.GetSection(ProfileSection(profile, "tokens")); err == nil {
+				helper = section.Key("credential_helper").String()
+			}
+		}
+	}
+
+	return CredentialChain{
+		EnvCredentials{},
+		FileCredentials{Filename: filename, Profile: profile},
+		HelperCredentials{Command: helper, Profile: profile},
+	}
+}
+
+// WithCredentialProvider sets the tokens and role from p
+func WithCredentialProvider(p CredentialProvider) Option {
+	return func(k *Client) error {
+		c, err := p.Credentials()
+		if err != nil {
+			return err
+		}
+
+		k.Tokens = &Ktokens{Public: c.Public, Private: c.Private}
+		if c.RoleUUID != "" {
+			k.RoleUUID = c.RoleUUID
+		}
+		return nil
+	}
+}
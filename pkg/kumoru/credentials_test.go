@@ -0,0 +1,158 @@
+/*
+Copyright 2016 Kumoru.io
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kumoru
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnvCredentials(t *testing.T) {
+	os.Clearenv()
+
+	_, err := EnvCredentials{}.Credentials()
+	assert.Equal(t, ErrNoCredentials, err)
+
+	os.Setenv("KUMORU_TOKEN_PUBLIC", "ENV_PUBLIC")
+	os.Setenv("KUMORU_TOKEN_PRIVATE", "ENV_PRIVATE")
+	os.Setenv("KUMORU_ROLE_UUID", "ENV_ROLE")
+	defer os.Clearenv()
+
+	c, err := EnvCredentials{}.Credentials()
+	assert.Nil(t, err)
+	assert.Equal(t, Credentials{Public: "ENV_PUBLIC", Private: "ENV_PRIVATE", RoleUUID: "ENV_ROLE"}, c)
+}
+
+func TestFileCredentials(t *testing.T) {
+	c, err := FileCredentials{Filename: "example-cfg.ini", Profile: DefaultProfile}.Credentials()
+	assert.Nil(t, err)
+	assert.Equal(t, Credentials{Public: "PUBLIC_TOKEN", Private: "PRIVATE_TOKEN", RoleUUID: "ROLE_UUID"}, c)
+
+	c, err = FileCredentials{Filename: "example-cfg.ini", Profile: "staging"}.Credentials()
+	assert.Nil(t, err)
+	assert.Equal(t, "STAGING_PUBLIC", c.Public)
+
+	_, err = FileCredentials{Filename: "fake-file.ini"}.Credentials()
+	assert.Equal(t, ErrNoCredentials, err)
+}
+
+func TestCredentialChain(t *testing.T) {
+	os.Clearenv()
+	defer os.Clearenv()
+
+	chain := CredentialChain{
+		StaticCredentials{},
+		EnvCredentials{},
+		FileCredentials{Filename: "example-cfg.ini"},
+	}
+
+	c, err := chain.Credentials()
+	assert.Nil(t, err)
+	assert.Equal(t, Credentials{Public: "PUBLIC_TOKEN", Private: "PRIVATE_TOKEN", RoleUUID: "ROLE_UUID"}, c)
+
+	os.Setenv("KUMORU_ROLE_UUID", "ENV_ROLE")
+	c, err = chain.Credentials()
+	assert.Nil(t, err)
+	assert.Equal(t, Credentials{Public: "PUBLIC_TOKEN", Private: "PRIVATE_TOKEN", RoleUUID: "ENV_ROLE"}, c, "role from the environment, tokens from the file")
+
+	chain[0] = StaticCredentials{Public: "EXPLICIT_PUBLIC", Private: "EXPLICIT_PRIVATE"}
+	c, err = chain.Credentials()
+	assert.Nil(t, err)
+	assert.Equal(t, "EXPLICIT_PUBLIC", c.Public)
+
+	_, err = CredentialChain{EnvCredentials{}, FileCredentials{Filename: "fake-file.ini"}}.Credentials()
+	assert.Equal(t, ErrNoCredentials, err)
+}
+
+func TestHelperCredentials(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("helper script requires a POSIX shell")
+	}
+
+	dir, err := ioutil.TempDir("", "kumoru")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	helper := dir + "/helper"
+	script := fmt.Sprintf(`#!/bin/sh
+echo run >> %s/runs
+[ "$1" = get ] || exit 2
+echo '{"public_token": "HELPER_PUBLIC", "private_token": "HELPER_PRIVATE", "role_uuid": "'$KUMORU_PROFILE'"}'
+`, dir)
+	ioutil.WriteFile(helper, []byte(script), 0700)
+
+	h := HelperCredentials{Command: helper, Profile: "vault"}
+
+	for i := 0; i < 2; i++ {
+		c, err := h.Credentials()
+		assert.Nil(t, err)
+		assert.Equal(t, Credentials{Public: "HELPER_PUBLIC", Private: "HELPER_PRIVATE", RoleUUID: "vault"}, c)
+	}
+
+	runs, _ := ioutil.ReadFile(dir + "/runs")
+	assert.Equal(t, "run\n", string(runs), "the helper result is cached")
+
+	_, err = HelperCredentials{Command: helper + " unexpected"}.Credentials()
+	assert.NotNil(t, err, "a failing helper is reported")
+
+	_, err = HelperCredentials{Command: " \t"}.Credentials()
+	assert.Equal(t, ErrNoCredentials, err, "a blank command is no helper")
+
+	os.Remove(dir + "/runs")
+	h = HelperCredentials{Command: helper, Profile: "concurrent"}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c, err := h.Credentials()
+			assert.Nil(t, err)
+			assert.Equal(t, "concurrent", c.RoleUUID)
+		}()
+	}
+	wg.Wait()
+
+	runs, _ = ioutil.ReadFile(dir + "/runs")
+	assert.Equal(t, "run\n", string(runs), "concurrent callers share one run")
+
+	os.Clearenv()
+	defer os.Clearenv()
+	os.Setenv("KUMORU_CREDENTIAL_HELPER", helper)
+
+	c, err := DefaultCredentials("fake-file.ini", "vault").Credentials()
+	assert.Nil(t, err)
+	assert.Equal(t, "HELPER_PUBLIC", c.Public)
+}
+
+func TestWithCredentialProvider(t *testing.T) {
+	k, err := NewClient(WithCredentialProvider(StaticCredentials{Public: "PUBLIC", Private: "PRIVATE", RoleUUID: "ROLE"}))
+	if assert.Nil(t, err) {
+		assert.Equal(t, "PUBLIC", k.Tokens.Public)
+		assert.Equal(t, "ROLE", k.RoleUUID)
+	}
+
+	_, err = NewClient(WithCredentialProvider(CredentialChain{}))
+	assert.Equal(t, ErrNoCredentials, err)
+}
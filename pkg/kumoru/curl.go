@@ -0,0 +1,83 @@
+/*
+Copyright 2016 Kumoru.io
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kumoru
+
+import (
+	"context"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+// Curl returns the request k would send, built and signed as End would, as a curl command line.
+// The command carries the real signature and is valid only while the server accepts its X-Kumoru-Date.
+// A BodyReader is not included; the command reads the body from standard input instead, and the
+// BodyReader is rewound afterwards for End.
+func (k *Client) Curl() (string, error) {
+	if k.BodyReader != nil {
+		body, err := newRequestBody(k.BodyReader)
+		if err != nil {
+			return "", err
+		}
+
+		k.body = body
+		defer func() {
+			body.rewind()
+			k.body = nil
+		}()
+	}
+
+	req, err := k.prepareRequest(context.Background())
+	if err != nil {
+		return "", err
+	}
+
+	names := make([]string, 0, len(req.Header))
+	for name := range req.Header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	args := []string{"curl", "-X", req.Method}
+	for _, name := range names {
+		for _, v := range req.Header[name] {
+			args = append(args, "-H", shellQuote(name+": "+v))
+		}
+	}
+
+	switch {
+	case k.body != nil:
+		args = append(args, "--data-binary", "@-")
+	case req.Body != nil:
+		b, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return "", err
+		}
+		if len(b) > 0 {
+			args = append(args, "--data-binary", shellQuote(string(b)))
+		}
+	}
+
+	args = append(args, shellQuote(req.URL.String()))
+
+	return strings.Join(args, " "), nil
+}
+
+// shellQuote quotes s for a POSIX shell
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
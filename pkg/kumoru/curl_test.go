@@ -0,0 +1,63 @@
+/*
+Copyright 2016 Kumoru.io
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kumoru
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCurl(t *testing.T) {
+	k := testSignedClient("https://application.example/v1/secrets/")
+	k.Method = POST
+	k.Send("value=it's&labels=db")
+
+	cmd, err := k.Curl()
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(cmd, "curl -X POST "))
+	assert.Contains(t, cmd, "-H 'Authorization: ")
+	assert.Contains(t, cmd, "-H 'X-Kumoru-Date: ")
+	assert.Contains(t, cmd, "-H 'Content-Md5: ")
+	assert.Contains(t, cmd, `--data-binary 'value=it'\''s&labels=db'`)
+	assert.True(t, strings.HasSuffix(cmd, " 'https://application.example/v1/secrets/'"))
+}
+
+func TestCurlBodyReader(t *testing.T) {
+	var received string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		received = string(b)
+	}))
+	defer ts.Close()
+
+	k := testSignedClient(ts.URL + "/v1/applications/")
+	k.Method = PUT
+	k.BodyReader = strings.NewReader("image data")
+
+	cmd, err := k.Curl()
+	assert.Nil(t, err)
+	assert.Contains(t, cmd, "--data-binary @-")
+
+	_, _, errs := k.End()
+	assert.Nil(t, errs)
+	assert.Equal(t, "image data", received, "Curl leaves the body to be sent")
+}
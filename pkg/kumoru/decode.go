@@ -0,0 +1,258 @@
+/*
+Copyright 2016 Kumoru.io
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kumoru
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Kinds of SchemaWarning
+const (
+	// UnknownField is a field of the response which the decoded type does not declare.
+	UnknownField = "unknown"
+	// MissingField is a field the decoded type declares without omitempty which the response lacks.
+	MissingField = "missing"
+)
+
+// SchemaWarning reports a difference between a JSON response and the type it was decoded into,
+// found by strict decoding. Warnings point at drift between the API and the SDK; decoding still succeeds.
+type SchemaWarning struct {
+	Method string
+	URL    string
+	// Type is the Go type the response was decoded into.
+	Type string
+	// Field is the path of the field, such as certificates.private_key or [].uuid.
+	Field string
+	Kind  string
+}
+
+func (w SchemaWarning) String() string {
+	return fmt.Sprintf("%s field %s decoding %s %s into %s", w.Kind, w.Field, w.Method, w.URL, w.Type)
+}
+
+// StrictDecodingFromEnvironment reports whether KUMORU_STRICT_DECODING is set to true
+func StrictDecodingFromEnvironment() bool {
+	return strings.ToLower(os.Getenv("KUMORU_STRICT_DECODING")) == "true"
+}
+
+// EndJSON sends the request, returns any error from the response as CheckResponse does and decodes
+// the JSON body of a successful response into out. An empty body leaves out unchanged.
+func (k *Client) EndJSON(ctx context.Context, out interface{}) (*http.Response, error) {
+	resp, body, errs := k.EndBytesContext(ctx)
+	if len(errs) > 0 {
+		return resp, errs[0]
+	}
+
+	if err := k.CheckResponse(resp, body); err != nil {
+		return resp, err
+	}
+
+	return resp, k.DecodeJSON(resp, body, out)
+}
+
+// DecodeJSON decodes body, the body of resp, into out. The response must have a JSON content type, or none.
+// In strict mode the differences between the body and the type of out are passed to OnSchemaWarning,
+// or logged as warnings when it is nil.
+func (k *Client) DecodeJSON(resp *http.Response, body []byte, out interface{}) error {
+	if len(body) == 0 {
+		return nil
+	}
+
+	if contentType := resp.Header.Get("Content-Type"); contentType != "" {
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err != nil || !(mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")) {
+			method, u := k.describeRequest(resp)
+			return fmt.Errorf("kumoru: %s %s answered with %s, not JSON", method, u, contentType)
+		}
+	}
+
+	if err := json.Unmarshal(body, out); err != nil {
+		return err
+	}
+
+	if k.Strict && !IsDryRun(resp) {
+		var doc interface{}
+		json.Unmarshal(body, &doc)
+
+		method, u := k.describeRequest(resp)
+		for _, w := range schemaDrift(reflect.TypeOf(out), doc, "") {
+			w.Method, w.URL = method, u
+			w.Type = reflect.TypeOf(out).String()
+			k.schemaWarning(w)
+		}
+	}
+
+	return nil
+}
+
+// describeRequest returns the method and redacted URL of the request resp answers
+func (k *Client) describeRequest(resp *http.Response) (string, string) {
+	if resp.Request == nil {
+		return "", ""
+	}
+	return resp.Request.Method, k.redactor().URL(resp.Request.URL)
+}
+
+func (k *Client) schemaWarning(w SchemaWarning) {
+	if k.OnSchemaWarning != nil {
+		k.OnSchemaWarning(w)
+		return
+	}
+	if k.Logger != nil {
+		k.Logger.Warnf("kumoru: schema drift: %s", w)
+	}
+}
+
+// schemaDrift compares the decoded JSON value doc with t. Elements of arrays and values of maps share one path,
+// so that a field missing from every element is reported once.
+func schemaDrift(t reflect.Type, doc interface{}, path string) []SchemaWarning {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	var warnings []SchemaWarning
+	seen := make(map[SchemaWarning]bool)
+	add := func(ws []SchemaWarning) {
+		for _, w := range ws {
+			if !seen[w] {
+				seen[w] = true
+				warnings = append(warnings, w)
+			}
+		}
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		object, ok := doc.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+
+		fields := jsonFields(t)
+		matched := make(map[string]bool)
+
+		keys := make([]string, 0, len(object))
+		for key := range object {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			f, ok := fields[strings.ToLower(key)]
+			if !ok {
+				add([]SchemaWarning{{Field: joinPath(path, key), Kind: UnknownField}})
+				continue
+			}
+			matched[strings.ToLower(key)] = true
+			add(schemaDrift(f.Type, object[key], joinPath(path, key)))
+		}
+
+		names := make([]string, 0, len(fields))
+		for name := range fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			if !matched[name] && !fields[name].omitEmpty {
+				add([]SchemaWarning{{Field: joinPath(path, fields[name].name), Kind: MissingField}})
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		if list, ok := doc.([]interface{}); ok {
+			for _, item := range list {
+				add(schemaDrift(t.Elem(), item, path+"[]"))
+			}
+		}
+	case reflect.Map:
+		if object, ok := doc.(map[string]interface{}); ok {
+			for _, value := range object {
+				add(schemaDrift(t.Elem(), value, joinPath(path, "*")))
+			}
+		}
+	}
+
+	return warnings
+}
+
+type jsonField struct {
+	name      string
+	omitEmpty bool
+	reflect.StructField
+}
+
+// jsonFields returns the fields encoding/json decodes into t, keyed by their lower case names
+func jsonFields(t reflect.Type) map[string]jsonField {
+	fields := make(map[string]jsonField)
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" || (f.PkgPath != "" && !f.Anonymous) {
+			continue
+		}
+
+		name, options := tag, ""
+		if i := strings.Index(tag, ","); i >= 0 {
+			name, options = tag[:i], tag[i:]
+		}
+
+		ft := f.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			for key, embedded := range jsonFields(ft) {
+				if _, ok := fields[key]; !ok {
+					fields[key] = embedded
+				}
+			}
+			continue
+		}
+
+		if name == "" {
+			name = f.Name
+		}
+		fields[strings.ToLower(name)] = jsonField{name: name, omitEmpty: strings.Contains(options, ",omitempty"), StructField: f}
+	}
+
+	return fields
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// WithStrictDecoding reports the schema drift found by DecodeJSON to handler, or logs it when handler is nil
+func WithStrictDecoding(handler func(SchemaWarning)) Option {
+	return func(k *Client) error {
+		k.Strict = true
+		k.OnSchemaWarning = handler
+		return nil
+	}
+}
@@ -0,0 +1,123 @@
+/*
+Copyright 2016 Kumoru.io
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kumoru
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testApplication struct {
+	UUID         string `json:"uuid"`
+	Name         string `json:"name"`
+	Status       string `json:"status,omitempty"`
+	Certificates struct {
+		Certificate string `json:"certificate"`
+	} `json:"certificates,omitempty"`
+}
+
+func TestEndJSON(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/text":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte("<html></html>"))
+		case "/missing":
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":"not_found","message":"no such application"}`))
+		default:
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.Write([]byte(`{"uuid":"1234","name":"web"}`))
+		}
+	}))
+	defer ts.Close()
+
+	k := testSignedClient(ts.URL + "/v1/applications/1234")
+	k.Method = GET
+
+	var app testApplication
+	resp, err := k.EndJSON(context.Background(), &app)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "web", app.Name)
+
+	k.Get(ts.URL + "/text")
+	_, err = k.EndJSON(context.Background(), &app)
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "text/html")
+	}
+
+	k.Get(ts.URL + "/missing")
+	_, err = k.EndJSON(context.Background(), &app)
+	assert.True(t, IsNotFound(err))
+}
+
+func TestStrictDecoding(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[
+			{"uuid":"1","Name":"web","region":"us-east-1","certificates":{"certificate":"C","chain":"X"}},
+			{"uuid":"2","Name":"db","region":"us-east-1"}
+		]`))
+	}))
+	defer ts.Close()
+
+	var warnings []SchemaWarning
+	k := testSignedClient(ts.URL + "/v1/applications/?deployment_token=TOKEN")
+	assert.Nil(t, WithStrictDecoding(func(w SchemaWarning) { warnings = append(warnings, w) })(k))
+	k.Method = GET
+
+	var apps []testApplication
+	_, err := k.EndJSON(context.Background(), &apps)
+	assert.Nil(t, err)
+	assert.Len(t, apps, 2)
+
+	fields := map[string]string{}
+	for _, w := range warnings {
+		fields[w.Field] = w.Kind
+		assert.Equal(t, GET, w.Method)
+		assert.NotContains(t, w.URL, "TOKEN")
+		assert.Equal(t, "*[]kumoru.testApplication", w.Type)
+	}
+	assert.Equal(t, map[string]string{
+		"[].region":             UnknownField,
+		"[].certificates.chain": UnknownField,
+	}, fields, "matching is case insensitive, omitempty fields may be absent and each path is reported once")
+
+	warnings = nil
+	var app struct {
+		UUID  string `json:"uuid"`
+		Owner string `json:"owner_uuid"`
+	}
+	k.Get(ts.URL + "/v1/applications/1")
+	ts.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"uuid":"1"}`))
+	})
+	_, err = k.EndJSON(context.Background(), &app)
+	assert.Nil(t, err)
+	if assert.Len(t, warnings, 1) {
+		assert.Equal(t, "owner_uuid", warnings[0].Field)
+		assert.Equal(t, MissingField, warnings[0].Kind)
+		assert.Equal(t, ts.URL+"/v1/applications/1", warnings[0].URL)
+	}
+}
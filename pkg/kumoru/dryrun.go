@@ -0,0 +1,166 @@
+/*
+Copyright 2016 Kumoru.io
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kumoru
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+)
+
+// DryRunHeader marks the synthetic responses of a dry run
+const DryRunHeader = "X-Kumoru-Dry-Run"
+
+// DryRunRequest describes a request which was built and signed but not sent.
+// Sensitive headers, query parameters and body fields are redacted.
+type DryRunRequest struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header"`
+	Body   string      `json:"body,omitempty"`
+}
+
+// dryRunResponse is the body of a synthetic response. The request is nested under a key of its own
+// so that decoding the body into a service's type leaves that value unchanged.
+type dryRunResponse struct {
+	DryRun DryRunRequest `json:"dry_run"`
+}
+
+// DryRunFromEnvironment reports whether KUMORU_DRY_RUN is set to true
+func DryRunFromEnvironment() bool {
+	return strings.ToLower(os.Getenv("KUMORU_DRY_RUN")) == "true"
+}
+
+// IsDryRun reports whether resp is the synthetic response to a request which was not sent
+func IsDryRun(resp *http.Response) bool {
+	return resp != nil && resp.Header.Get(DryRunHeader) == "true"
+}
+
+// SetDryRun enables dry runs. POST, PUT, PATCH and DELETE requests are then built and signed,
+// written to DryRunOutput when it is set, and answered without contacting the server.
+// Other requests are sent as usual unless they are marked with SetMutating.
+func (k *Client) SetDryRun(enable bool) {
+	k.DryRun = enable
+}
+
+// dryRun answers mutating requests with a synthetic response describing them, passing the rest to next
+func (k *Client) dryRun(next RoundTripFunc) RoundTripFunc {
+	return func(req *http.Request) (*http.Response, error) {
+		if !hasBody(req.Method) && req.Method != DELETE && !k.mutating {
+			return next(req)
+		}
+
+		d := k.newDryRunRequest(req)
+
+		if k.DryRunOutput != nil {
+			fmt.Fprint(k.DryRunOutput, d)
+		}
+
+		status := http.StatusCreated
+		switch req.Method {
+		case PATCH:
+			status = http.StatusOK
+		case DELETE:
+			status = http.StatusNoContent
+		}
+
+		body, err := json.Marshal(dryRunResponse{DryRun: d})
+		if err != nil {
+			return nil, err
+		}
+
+		return &http.Response{
+			Status:     fmt.Sprintf("%d %s", status, http.StatusText(status)),
+			StatusCode: status,
+			Proto:      "HTTP/1.1",
+			ProtoMajor: 1,
+			ProtoMinor: 1,
+			Header: http.Header{
+				"Content-Type": {"application/json"},
+				DryRunHeader:   {"true"},
+			},
+			Body:          ioutil.NopCloser(bytes.NewReader(body)),
+			ContentLength: int64(len(body)),
+			Request:       req,
+		}, nil
+	}
+}
+
+func (k *Client) newDryRunRequest(req *http.Request) DryRunRequest {
+	r := k.redactor()
+	d := DryRunRequest{
+		Method: req.Method,
+		URL:    r.URL(req.URL),
+		Header: r.Header(req.Header),
+	}
+
+	if req.Body == nil {
+		return d
+	}
+	defer req.Body.Close()
+
+	// Streamed bodies are too large to echo and cannot be read twice.
+	if k.body != nil {
+		d.Body = fmt.Sprintf("(%d bytes)", k.body.size)
+		return d
+	}
+
+	b, _ := ioutil.ReadAll(req.Body)
+	d.Body = r.Body(req.Header.Get("Content-Type"), b)
+
+	return d
+}
+
+// String formats d as the request line, headers and body of an HTTP request
+func (d DryRunRequest) String() string {
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "%s %s\n", d.Method, d.URL)
+
+	names := make([]string, 0, len(d.Header))
+	for name := range d.Header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		for _, v := range d.Header[name] {
+			fmt.Fprintf(&buf, "%s: %s\n", name, v)
+		}
+	}
+
+	if d.Body != "" {
+		fmt.Fprintf(&buf, "\n%s\n", d.Body)
+	}
+
+	return buf.String()
+}
+
+// WithDryRun enables dry runs, writing each request which is not sent to w. w may be nil.
+func WithDryRun(w io.Writer) Option {
+	return func(k *Client) error {
+		k.DryRun = true
+		k.DryRunOutput = w
+		return nil
+	}
+}
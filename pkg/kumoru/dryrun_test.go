@@ -0,0 +1,96 @@
+/*
+Copyright 2016 Kumoru.io
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kumoru
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDryRun(t *testing.T) {
+	var hits int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.Write([]byte(`[]`))
+	}))
+	defer ts.Close()
+
+	var out bytes.Buffer
+	k := testSignedClient(ts.URL + "/v1/applications/")
+	assert.Nil(t, WithDryRun(&out)(k))
+	k.Method = POST
+	k.TargetType = "json"
+	k.RawString = `{"name":"web"}`
+
+	resp, body, errs := k.End()
+	assert.Nil(t, errs)
+	assert.Equal(t, int32(0), hits)
+	assert.True(t, IsDryRun(resp))
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	var app struct {
+		Name string `json:"name"`
+		URL  string `json:"url"`
+	}
+	app.URL = "https://web.example"
+	assert.Nil(t, json.Unmarshal([]byte(body), &app))
+	assert.Equal(t, "https://web.example", app.URL, "decoding a synthetic response leaves the value unchanged")
+
+	var d dryRunResponse
+	assert.Nil(t, json.Unmarshal([]byte(body), &d))
+	assert.Equal(t, POST, d.DryRun.Method)
+	assert.Equal(t, `{"name":"web"}`, d.DryRun.Body)
+	assert.Equal(t, Redacted, d.DryRun.Header.Get("Authorization"))
+	assert.NotEmpty(t, d.DryRun.Header.Get("Content-Md5"), "the request is signed")
+
+	assert.True(t, strings.HasPrefix(out.String(), "POST "+ts.URL+"/v1/applications/\n"))
+	assert.Contains(t, out.String(), "Authorization: [REDACTED]\n")
+	assert.Contains(t, out.String(), "\n\n{\"name\":\"web\"}\n")
+
+	k = k.Clone()
+	k.Delete(ts.URL + "/v1/applications/1234")
+	resp, _, _ = k.End()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	assert.Equal(t, int32(0), hits)
+
+	k.Get(ts.URL + "/v1/applications/")
+	resp, _, errs = k.End()
+	assert.Nil(t, errs)
+	assert.False(t, IsDryRun(resp))
+	assert.Equal(t, int32(1), hits, "reads are sent during a dry run")
+
+	k.Get(ts.URL + "/v1/accounts/user@example.com/password/resets/")
+	k.SetMutating(true)
+	resp, body, _ = k.End()
+	assert.True(t, IsDryRun(resp))
+	assert.Equal(t, int32(1), hits, "requests marked as mutating are not sent")
+
+	k.Post(ts.URL + "/v1/tokens/")
+	k.TargetType = "json"
+	k.RawString = `{"email":"user@example.com","password":"hunter2"}`
+	_, body, _ = k.End()
+	assert.Nil(t, json.Unmarshal([]byte(body), &d))
+	assert.Equal(t, `{"email":"user@example.com","password":"`+Redacted+`"}`, d.DryRun.Body)
+	assert.NotContains(t, out.String(), "hunter2")
+}
@@ -22,6 +22,13 @@ import (
 	"github.com/go-ini/ini"
 )
 
+// Default endpoints for the hosted Kumoru api services
+const (
+	DefaultApplicationURL   = "https://application.api.kumoru.io"
+	DefaultAuthorizationURL = "https://authorization.api.kumoru.io"
+	DefaultLocationURL      = "https://location.api.kumoru.io"
+)
+
 // Endpoints struct for all api services
 type Endpoints struct {
 	Application   string
@@ -33,41 +40,42 @@ type Endpoints struct {
 func LoadEndpoints(filename string, section string) Endpoints {
 	config, err := ini.Load(filename)
 
-	appManagerURL := "https://application.api.kumoru.io"
+	if err != nil {
+		return defaultEndpoints()
+	}
+
+	iniEndpoints, err := config.GetSection(section)
+	if err != nil {
+		return defaultEndpoints()
+	}
+
+	return Endpoints{
+		Application:   iniEndpoints.Key("kumoru_application_api").String(),
+		Authorization: iniEndpoints.Key("kumoru_authorization_api").String(),
+		Location:      iniEndpoints.Key("kumoru_location_api").String(),
+	}
+}
+
+// defaultEndpoints returns the hosted endpoints, overridden by the *_MANAGER_URL environment variables
+func defaultEndpoints() Endpoints {
+	appManagerURL := DefaultApplicationURL
 	if os.Getenv("APPLICATION_MANAGER_URL") != "" {
 		appManagerURL = os.Getenv("APPLICATION_MANAGER_URL")
 	}
 
-	authManagerURL := "https://authorization.api.kumoru.io"
+	authManagerURL := DefaultAuthorizationURL
 	if os.Getenv("AUTHORIZATION_MANAGER_URL") != "" {
 		authManagerURL = os.Getenv("AUTHORIZATION_MANAGER_URL")
 	}
 
-	locationManagerURL := "https://location.api.kumoru.io"
+	locationManagerURL := DefaultLocationURL
 	if os.Getenv("LOCATION_MANAGER_URL") != "" {
 		locationManagerURL = os.Getenv("LOCATION_MANAGER_URL")
 	}
 
-	if err != nil {
-		return Endpoints{
-			Application:   appManagerURL,
-			Authorization: authManagerURL,
-			Location:      locationManagerURL,
-		}
-	}
-
-	iniEndpoints, err := config.GetSection(section)
-	if err != nil {
-		return Endpoints{
-			Application:   appManagerURL,
-			Authorization: authManagerURL,
-			Location:      locationManagerURL,
-		}
-	}
-
 	return Endpoints{
-		Application:   iniEndpoints.Key("kumoru_application_api").String(),
-		Authorization: iniEndpoints.Key("kumoru_authorization_api").String(),
-		Location:      iniEndpoints.Key("kumoru_location_api").String(),
+		Application:   appManagerURL,
+		Authorization: authManagerURL,
+		Location:      locationManagerURL,
 	}
 }
@@ -0,0 +1,197 @@
+/*
+Copyright 2016 Kumoru.io
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kumoru
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// APIError is returned for responses with a 4xx or 5xx status
+type APIError struct {
+	// StatusCode and Status are copied from the http response.
+	StatusCode int
+	Status     string
+	// Service names the api which answered: application, authorization or location.
+	Service string
+	// RequestID identifies the request in the service's logs.
+	RequestID string
+	// Code and Message are decoded from the response body when it is JSON.
+	Code    string
+	Message string
+	// Body is the raw response body.
+	Body []byte
+}
+
+func (e *APIError) Error() string {
+	msg := "kumoru: "
+	if e.Service != "" {
+		msg += e.Service + " api: "
+	}
+	msg += e.Status
+
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+
+	var details []string
+	if e.Code != "" {
+		details = append(details, "code: "+e.Code)
+	}
+	if e.RequestID != "" {
+		details = append(details, "request id: "+e.RequestID)
+	}
+	if len(details) > 0 {
+		msg += " (" + strings.Join(details, ", ") + ")"
+	}
+
+	return msg
+}
+
+// apiErrorBody holds the fields the Kumoru apis use to describe an error
+type apiErrorBody struct {
+	Code        interface{} `json:"code"`
+	ErrorCode   string      `json:"error_code"`
+	Message     string      `json:"message"`
+	Error       string      `json:"error"`
+	Description string      `json:"description"`
+}
+
+// CheckResponse returns an *APIError if resp has a 4xx or 5xx status, or nil otherwise.
+// body is the response body already read by End or EndBytes.
+func (k *Client) CheckResponse(resp *http.Response, body []byte) error {
+	if resp == nil || resp.StatusCode < 400 {
+		return nil
+	}
+
+	e := &APIError{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		Service:    k.serviceName(resp.Request),
+		RequestID:  requestID(resp),
+		Body:       body,
+	}
+
+	var b apiErrorBody
+	if err := json.Unmarshal(body, &b); err == nil {
+		switch code := b.Code.(type) {
+		case string:
+			e.Code = code
+		case float64:
+			e.Code = fmt.Sprintf("%v", code)
+		}
+		if e.Code == "" {
+			e.Code = b.ErrorCode
+		}
+
+		for _, m := range []string{b.Message, b.Error, b.Description} {
+			if m != "" {
+				e.Message = m
+				break
+			}
+		}
+	} else if len(body) > 0 && len(body) <= 512 {
+		e.Message = strings.TrimSpace(string(body))
+	}
+
+	return e
+}
+
+// serviceName reports which of k's endpoints req was sent to
+func (k *Client) serviceName(req *http.Request) string {
+	if req == nil || k.EndPoint == nil {
+		return ""
+	}
+
+	u := req.URL.String()
+	for name, endpoint := range map[string]string{
+		"application":   k.EndPoint.Application,
+		"authorization": k.EndPoint.Authorization,
+		"location":      k.EndPoint.Location,
+	} {
+		if endpoint != "" && strings.HasPrefix(u, strings.TrimRight(endpoint, "/")+"/") {
+			return name
+		}
+	}
+
+	return ""
+}
+
+// ErrorList wraps err for the functions which return []error. A nil err gives a nil list.
+func ErrorList(err error) []error {
+	if err == nil {
+		return nil
+	}
+	return []error{err}
+}
+
+// hasStatus reports whether err is or wraps an *APIError with one of codes
+func hasStatus(err error, codes ...int) bool {
+	var e *APIError
+	if !errors.As(err, &e) {
+		return false
+	}
+
+	for _, code := range codes {
+		if e.StatusCode == code {
+			return true
+		}
+	}
+	return false
+}
+
+// IsNotFound reports whether err is an *APIError with a 404 status
+func IsNotFound(err error) bool {
+	return hasStatus(err, http.StatusNotFound)
+}
+
+// IsConflict reports whether err is an *APIError with a 409 status
+func IsConflict(err error) bool {
+	return hasStatus(err, http.StatusConflict)
+}
+
+// IsUnauthorized reports whether err is an *APIError with a 401 status
+func IsUnauthorized(err error) bool {
+	return hasStatus(err, http.StatusUnauthorized)
+}
+
+// IsForbidden reports whether err is an *APIError with a 403 status
+func IsForbidden(err error) bool {
+	return hasStatus(err, http.StatusForbidden)
+}
+
+// IsValidation reports whether err is an *APIError with a 400 or 422 status
+func IsValidation(err error) bool {
+	return hasStatus(err, http.StatusBadRequest, http.StatusUnprocessableEntity)
+}
+
+// IsServerError reports whether err is an *APIError with a 5xx status
+func IsServerError(err error) bool {
+	var e *APIError
+	return errors.As(err, &e) && e.StatusCode >= 500
+}
+
+// requestID returns the id the service gave the request which produced resp
+func requestID(resp *http.Response) string {
+	if id := resp.Header.Get("X-Request-Id"); id != "" {
+		return id
+	}
+	return resp.Header.Get("X-Kumoru-Request-Id")
+}
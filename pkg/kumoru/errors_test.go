@@ -0,0 +1,115 @@
+/*
+Copyright 2016 Kumoru.io
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kumoru
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testResponse(code int, rawurl string, header http.Header) *http.Response {
+	u, _ := url.Parse(rawurl)
+	if header == nil {
+		header = http.Header{}
+	}
+
+	return &http.Response{
+		StatusCode: code,
+		Status:     http.StatusText(code),
+		Header:     header,
+		Request:    &http.Request{Method: "GET", URL: u},
+	}
+}
+
+func TestCheckResponseSuccess(t *testing.T) {
+	k := New()
+	assert.Nil(t, k.CheckResponse(testResponse(200, DefaultApplicationURL+"/v1/applications/", nil), nil))
+	assert.Nil(t, k.CheckResponse(nil, nil))
+}
+
+func TestCheckResponseDecodesBody(t *testing.T) {
+	k := New()
+	k.EndPoint = &Endpoints{Application: "https://application.example", Authorization: "https://authorization.example", Location: "https://location.example"}
+
+	header := http.Header{}
+	header.Set("X-Request-Id", "REQ-1")
+	resp := testResponse(409, "https://application.example/v1/applications/", header)
+
+	err := k.CheckResponse(resp, []byte(`{"code":"name_taken","message":"application name already in use"}`))
+
+	e, ok := err.(*APIError)
+	if !assert.True(t, ok) {
+		return
+	}
+	assert.Equal(t, 409, e.StatusCode)
+	assert.Equal(t, "application", e.Service)
+	assert.Equal(t, "REQ-1", e.RequestID)
+	assert.Equal(t, "name_taken", e.Code)
+	assert.Equal(t, "application name already in use", e.Message)
+	assert.Equal(t, "kumoru: application api: Conflict: application name already in use (code: name_taken, request id: REQ-1)", e.Error())
+	assert.True(t, IsConflict(err))
+	assert.False(t, IsNotFound(err))
+}
+
+func TestCheckResponsePlainBody(t *testing.T) {
+	k := New()
+	k.EndPoint = &Endpoints{Authorization: "https://authorization.example"}
+
+	header := http.Header{}
+	header.Set("X-Kumoru-Request-Id", "REQ-2")
+	resp := testResponse(503, "https://authorization.example/v1/secrets/", header)
+
+	err := k.CheckResponse(resp, []byte("upstream unavailable\n"))
+
+	e := err.(*APIError)
+	assert.Equal(t, "authorization", e.Service)
+	assert.Equal(t, "REQ-2", e.RequestID)
+	assert.Equal(t, "upstream unavailable", e.Message)
+	assert.True(t, IsServerError(err))
+}
+
+func TestErrorHelpers(t *testing.T) {
+	cases := []struct {
+		code      int
+		predicate func(error) bool
+	}{
+		{400, IsValidation},
+		{401, IsUnauthorized},
+		{403, IsForbidden},
+		{404, IsNotFound},
+		{409, IsConflict},
+		{422, IsValidation},
+		{500, IsServerError},
+	}
+
+	for _, c := range cases {
+		assert.True(t, c.predicate(&APIError{StatusCode: c.code}), "status %d", c.code)
+		assert.False(t, c.predicate(&APIError{StatusCode: 200}), "status %d", c.code)
+		assert.False(t, c.predicate(errors.New("boom")), "status %d", c.code)
+
+		wrapped := fmt.Errorf("deleting application: %w", &APIError{StatusCode: c.code})
+		assert.True(t, c.predicate(wrapped), "wrapped status %d", c.code)
+	}
+
+	assert.Nil(t, ErrorList(nil))
+	assert.Len(t, ErrorList(errors.New("boom")), 1)
+}
@@ -0,0 +1,289 @@
+/*
+Copyright 2016 Kumoru.io
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kumoru
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// HARRecorder keeps the requests a Client sends, and their responses, as an HTTP Archive (HAR 1.2)
+// which can be opened in browser developer tools. Headers, URLs and bodies are passed through
+// Redactor, so the archive can be shared. Add it to the end of the chain with WithHAR, or with Use.
+type HARRecorder struct {
+	// Redactor scrubs what is recorded; it defaults to DefaultRedactor.
+	Redactor *Redactor
+
+	mu      sync.Mutex
+	entries []*HAREntry
+}
+
+// HAR is the top level object of a HAR file
+type HAR struct {
+	Log HARLog `json:"log"`
+}
+
+// HARLog holds the recorded entries
+type HARLog struct {
+	Version string      `json:"version"`
+	Creator HARCreator  `json:"creator"`
+	Entries []*HAREntry `json:"entries"`
+}
+
+// HARCreator names the program which wrote the HAR
+type HARCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// HAREntry is one attempt of a request
+type HAREntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         HARRequest  `json:"request"`
+	Response        HARResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         HARTimings  `json:"timings"`
+	Comment         string      `json:"comment,omitempty"`
+}
+
+// HARRequest describes the request of an entry
+type HARRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARNameValue `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	QueryString []HARNameValue `json:"queryString"`
+	PostData    *HARPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+// HARResponse describes the response of an entry
+type HARResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARNameValue `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	Content     HARContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+// HARNameValue is a header, cookie or query parameter
+type HARNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// HARPostData is the body of a request
+type HARPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+// HARContent is the body of a response
+type HARContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+}
+
+// HARTimings splits the time of an entry. Only the wait for the response is measured.
+type HARTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// NewHARRecorder returns an empty HARRecorder using DefaultRedactor
+func NewHARRecorder() *HARRecorder {
+	return &HARRecorder{Redactor: DefaultRedactor()}
+}
+
+// Middleware records each attempt passing through the chain. Response bodies are recorded as they are
+// read, so a streamed response appears in the archive once it has been closed.
+func (h *HARRecorder) Middleware(next RoundTripFunc) RoundTripFunc {
+	return func(req *http.Request) (*http.Response, error) {
+		r := h.redactor()
+
+		entry := &HAREntry{
+			StartedDateTime: time.Now().Format("2006-01-02T15:04:05.000Z07:00"),
+			Request: HARRequest{
+				Method:      req.Method,
+				URL:         r.URL(req.URL),
+				HTTPVersion: "HTTP/1.1",
+				Cookies:     []HARNameValue{},
+				Headers:     harNameValues(r.Header(req.Header)),
+				QueryString: harNameValues(r.values(req.URL.Query())),
+				HeadersSize: -1,
+				BodySize:    req.ContentLength,
+			},
+		}
+
+		// Bodies with a GetBody can be read without consuming what the transport will send;
+		// streamed uploads are left out.
+		if req.GetBody != nil {
+			if body, err := req.GetBody(); err == nil {
+				b, _ := ioutil.ReadAll(body)
+				body.Close()
+				contentType := req.Header.Get("Content-Type")
+				entry.Request.PostData = &HARPostData{MimeType: contentType, Text: r.Body(contentType, b)}
+			}
+		}
+
+		start := time.Now()
+		resp, err := next(req)
+		entry.Time = time.Since(start).Seconds() * 1000
+		entry.Timings.Wait = entry.Time
+
+		if err != nil {
+			entry.Comment = err.Error()
+			h.add(entry)
+			return resp, err
+		}
+
+		entry.Response = HARResponse{
+			Status:      resp.StatusCode,
+			StatusText:  http.StatusText(resp.StatusCode),
+			HTTPVersion: resp.Proto,
+			Cookies:     []HARNameValue{},
+			Headers:     harNameValues(r.Header(resp.Header)),
+			Content:     HARContent{Size: -1, MimeType: resp.Header.Get("Content-Type")},
+			HeadersSize: -1,
+			BodySize:    resp.ContentLength,
+		}
+		h.add(entry)
+
+		resp.Body = &harBody{ReadCloser: resp.Body, done: func(b []byte) {
+			h.mu.Lock()
+			defer h.mu.Unlock()
+
+			entry.Response.Content.Size = int64(len(b))
+			if !r.HidesBody(req.URL) {
+				entry.Response.Content.Text = r.Body(entry.Response.Content.MimeType, b)
+			}
+		}}
+
+		return resp, nil
+	}
+}
+
+// HAR returns a copy of the archive recorded so far
+func (h *HARRecorder) HAR() *HAR {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	entries := make([]*HAREntry, len(h.entries))
+	for i, e := range h.entries {
+		c := *e
+		entries[i] = &c
+	}
+
+	return &HAR{Log: HARLog{
+		Version: "1.2",
+		Creator: HARCreator{Name: "kumoru-sdk-go", Version: Version},
+		Entries: entries,
+	}}
+}
+
+// WriteTo writes the archive recorded so far to w as JSON
+func (h *HARRecorder) WriteTo(w io.Writer) (int64, error) {
+	b, err := json.MarshalIndent(h.HAR(), "", "  ")
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := w.Write(append(b, '\n'))
+	return int64(n), err
+}
+
+// Save writes the archive recorded so far to filename
+func (h *HARRecorder) Save(filename string) error {
+	var buf bytes.Buffer
+	if _, err := h.WriteTo(&buf); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, buf.Bytes(), os.FileMode(0600))
+}
+
+func (h *HARRecorder) add(entry *HAREntry) {
+	h.mu.Lock()
+	h.entries = append(h.entries, entry)
+	h.mu.Unlock()
+}
+
+func (h *HARRecorder) redactor() *Redactor {
+	if h.Redactor != nil {
+		return h.Redactor
+	}
+	return DefaultRedactor()
+}
+
+// harNameValues flattens headers or query parameters, sorted by name
+func harNameValues(m map[string][]string) []HARNameValue {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := []HARNameValue{}
+	for _, name := range names {
+		for _, v := range m[name] {
+			pairs = append(pairs, HARNameValue{Name: name, Value: v})
+		}
+	}
+	return pairs
+}
+
+// harBody copies a response body as it is read and passes the copy to done when it is closed
+type harBody struct {
+	io.ReadCloser
+	buf  bytes.Buffer
+	done func([]byte)
+	once sync.Once
+}
+
+func (b *harBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.buf.Write(p[:n])
+	return n, err
+}
+
+func (b *harBody) Close() error {
+	b.once.Do(func() { b.done(b.buf.Bytes()) })
+	return b.ReadCloser.Close()
+}
+
+// WithHAR records every attempt in h, adding its middleware at the end of the chain
+func WithHAR(h *HARRecorder) Option {
+	return func(k *Client) error {
+		k.Use("har", h.Middleware)
+		return nil
+	}
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2016 Kumoru.io
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kumoru
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHARRecorder(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasPrefix(r.URL.Path, "/v1/tokens/") {
+			w.Write([]byte(`"PRIVATE"`))
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"uuid":"1234","value":"s3cr3t"}`))
+	}))
+	defer ts.Close()
+
+	h := NewHARRecorder()
+
+	k := testSignedClient(ts.URL + "/v1/secrets/")
+	k.Use("har", h.Middleware)
+	k.Method = POST
+	k.QueryData.Set("deployment_token", "TOKEN")
+	k.Send("value=s3cr3t&labels=db")
+	_, body, errs := k.End()
+	assert.Nil(t, errs)
+	assert.Contains(t, body, "s3cr3t")
+
+	k = testSignedClient(ts.URL + "/v1/tokens/PUBLIC")
+	assert.Nil(t, WithHAR(h)(k))
+	k.Method = GET
+	k.End()
+
+	har := h.HAR()
+	assert.Equal(t, "1.2", har.Log.Version)
+	if !assert.Len(t, har.Log.Entries, 2) {
+		return
+	}
+
+	e := har.Log.Entries[0]
+	assert.Equal(t, POST, e.Request.Method)
+	assert.Contains(t, e.Request.Headers, HARNameValue{Name: "Authorization", Value: Redacted})
+	assert.Contains(t, e.Request.QueryString, HARNameValue{Name: "deployment_token", Value: Redacted})
+	assert.NotContains(t, e.Request.URL, "TOKEN")
+	if assert.NotNil(t, e.Request.PostData) {
+		assert.Contains(t, e.Request.PostData.Text, "labels=db")
+	}
+	assert.Equal(t, http.StatusCreated, e.Response.Status)
+	assert.Contains(t, e.Response.Content.Text, `"uuid":"1234"`)
+
+	assert.Empty(t, har.Log.Entries[1].Response.Content.Text)
+	assert.Equal(t, int64(len(`"PRIVATE"`)), har.Log.Entries[1].Response.Content.Size)
+
+	var out bytes.Buffer
+	_, err := h.WriteTo(&out)
+	assert.Nil(t, err)
+	assert.NotContains(t, out.String(), "s3cr3t")
+	assert.NotContains(t, out.String(), "PRIVATE")
+
+	var decoded HAR
+	assert.Nil(t, json.Unmarshal([]byte(out.String()), &decoded))
+	assert.Len(t, decoded.Log.Entries, 2)
+}
@@ -18,17 +18,14 @@ package kumoru
 
 import (
 	"bytes"
-	"crypto/hmac"
-	"crypto/md5"
-	"crypto/sha256"
+	"context"
 	"crypto/tls"
-	"crypto/x509"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
-	"net/http/httputil"
 	"net/url"
 	"os"
 	"reflect"
@@ -36,8 +33,6 @@ import (
 	"time"
 
 	log "github.com/Sirupsen/logrus"
-
-	"github.com/kumoru/kumoru-sdk-go/RootCAs"
 )
 
 // Constant Methods
@@ -63,11 +58,13 @@ type (
 		Client            *http.Client
 		Data              map[string]interface{}
 		Debug             bool
+		DryRun            bool
+		DryRunOutput      io.Writer
 		EndPoint          *Endpoints
 		Errors            []error
 		FormData          url.Values
 		Header            map[string]string
-		Logger            *log.Logger
+		Logger            Logger
 		Method            string
 		ProxyRequestData  *http.Request
 		QueryData         url.Values
@@ -79,6 +76,24 @@ type (
 		Tokens            *Ktokens
 		Transport         *http.Transport
 		URL               string
+		Retry             *RetryPolicy
+		RateLimits        RateLimits
+		Redactor          *Redactor
+		UserAgent         string
+		BodyReader        io.ReadSeeker
+		Signer            Signer
+		Clock             func() time.Time
+		SigningVersion    int
+		Strict            bool
+		OnSchemaWarning   func(SchemaWarning)
+
+		anonymous   bool
+		body        *requestBody
+		mutating    bool
+		streaming   bool
+		stages      []stage
+		beforeHooks []BeforeHook
+		afterHooks  []AfterHook
 	}
 )
 
@@ -94,15 +109,32 @@ func New() *Client {
 
 	}
 
-	e := LoadEndpoints(config, "endpoints")
+	if err := CheckConfigPermissions(config); err != nil {
+		log.Warning(err)
+	}
 
-	t, err := LoadTokens(config, "tokens")
-	if err != nil {
+	profile := ActiveProfile()
+	if !HasProfile(config, profile) {
+		log.Warningf("Profile %s not found in %s.", profile, config)
+	}
+
+	e := LoadProfileEndpoints(config, profile)
+
+	signer := SignerFromEnvironment(config, profile)
+
+	creds, err := DefaultCredentials(config, profile).Credentials()
+	if err == ErrNoCredentials && signer != nil {
+		creds.Public = signer.PublicToken()
+	} else if err == ErrNoCredentials {
 		log.Warning("No tokens found.")
+	} else if err != nil {
+		log.Warning(err)
 	}
 
-	roleUUID, err := LoadRole(config, "auth")
-	if err != nil {
+	t := Ktokens{Public: creds.Public, Private: creds.Private}
+
+	roleUUID := creds.RoleUUID
+	if roleUUID == "" {
 		log.Warning("No active role found. Generate a new token.")
 	}
 
@@ -113,11 +145,30 @@ func New() *Client {
 
 	logger := log.New()
 
+	var dryRunOutput io.Writer
+	dryRun := DryRunFromEnvironment()
+	if dryRun {
+		dryRunOutput = os.Stdout
+	}
+
+	httpClient := &http.Client{}
+	trust := TrustFromEnvironment()
+	if trust.ClientCertificate.IsZero() {
+		trust.ClientCertificate = LoadClientCertificate(config, profile)
+	}
+
+	transport, err := transportFor(trust)
+	if err != nil {
+		httpClient.Transport = failingTransport{err}
+	}
+
 	return &Client{
 		BounceToRawString: false,
-		Client:            &http.Client{},
+		Client:            httpClient,
 		Data:              make(map[string]interface{}),
 		Debug:             envDebug,
+		DryRun:            dryRun,
+		DryRunOutput:      dryRunOutput,
 		EndPoint:          &e,
 		Errors:            nil,
 		FormData:          url.Values{},
@@ -125,35 +176,126 @@ func New() *Client {
 		Logger:            logger,
 		ProxyRequestData:  nil,
 		QueryData:         url.Values{},
+		RateLimits:        LoadRateLimits(config, profile),
 		RawString:         "",
 		RoleUUID:          roleUUID,
 		Sign:              false,
+		Signer:            signer,
+		SigningVersion:    signingVersionFromEnvironment(),
+		Strict:            StrictDecodingFromEnvironment(),
 		SliceData:         []interface{}{},
 		TargetType:        "form",
 		Tokens:            &t,
-		Transport:         &http.Transport{},
+		Transport:         transport,
 		URL:               "",
 	}
 
 }
 
+// Clone returns a new Client sharing k's configuration (endpoints, tokens, role, http client
+// settings, logger, debug flag, middleware and hooks) but with none of its per-request state. Clone lets a single
+// configured Client be used as a template for concurrent calls.
+func (k *Client) Clone() *Client {
+	httpClient := &http.Client{}
+	if k.Client != nil {
+		c := *k.Client
+		httpClient = &c
+	}
+
+	endpoints := &Endpoints{}
+	if k.EndPoint != nil {
+		e := *k.EndPoint
+		endpoints = &e
+	}
+
+	tokens := &Ktokens{}
+	if k.Tokens != nil {
+		t := *k.Tokens
+		tokens = &t
+	}
+
+	logger := k.Logger
+	if logger == nil {
+		logger = log.New()
+	}
+
+	transport := k.Transport
+	if transport == nil {
+		transport = DefaultTransport()
+	}
+
+	var stages []stage
+	if k.stages != nil {
+		stages = k.stageList()
+	}
+
+	return &Client{
+		BounceToRawString: false,
+		Client:            httpClient,
+		Data:              make(map[string]interface{}),
+		Debug:             k.Debug,
+		DryRun:            k.DryRun,
+		DryRunOutput:      k.DryRunOutput,
+		EndPoint:          endpoints,
+		Errors:            nil,
+		FormData:          url.Values{},
+		Header:            make(map[string]string),
+		Logger:            logger,
+		ProxyRequestData:  nil,
+		QueryData:         url.Values{},
+		RawString:         "",
+		Retry:             k.Retry,
+		RateLimits:        k.RateLimits,
+		Redactor:          k.Redactor,
+		RoleUUID:          k.RoleUUID,
+		Sign:              false,
+		Signer:            k.Signer,
+		Clock:             k.Clock,
+		SigningVersion:    k.SigningVersion,
+		Strict:            k.Strict,
+		OnSchemaWarning:   k.OnSchemaWarning,
+		SliceData:         []interface{}{},
+		TargetType:        "form",
+		Tokens:            tokens,
+		Transport:         transport,
+		URL:               "",
+		UserAgent:         k.UserAgent,
+
+		stages:      stages,
+		beforeHooks: append([]BeforeHook(nil), k.beforeHooks...),
+		afterHooks:  append([]AfterHook(nil), k.afterHooks...),
+	}
+}
+
 // SignRequest enables kumoru's authentication
 func (k *Client) SignRequest(enable bool) {
 	k.Sign = enable
 }
 
+// SetMutating marks the request as changing state on the server whatever its method,
+// so that a dry run does not send it
+func (k *Client) SetMutating(enable bool) {
+	k.mutating = enable
+}
+
 // SetDebug enables debugging
 func (k *Client) SetDebug(enable bool) {
 	k.Debug = enable
 }
 
+// SetRetryPolicy sets the policy used to retry failed requests. A nil policy disables retries.
+func (k *Client) SetRetryPolicy(policy *RetryPolicy) {
+	k.Retry = policy
+}
+
 // SetLogger enable logger
-func (k *Client) SetLogger(logger *log.Logger) {
+func (k *Client) SetLogger(logger Logger) {
 	k.Logger = logger
 }
 
 // ClearClient clears data for a new request
 func (k *Client) ClearClient() {
+	k.BodyReader = nil
 	k.BounceToRawString = false
 	k.Data = make(map[string]interface{})
 	k.Errors = nil
@@ -163,6 +305,7 @@ func (k *Client) ClearClient() {
 	k.QueryData = url.Values{}
 	k.RawString = ""
 	k.Sign = false
+	k.mutating = false
 	k.TargetType = "form"
 	k.URL = ""
 	k.SliceData = []interface{}{}
@@ -303,9 +446,9 @@ func (k *Client) queryStruct(content interface{}) {
 }
 
 // TLSClientConfig set TLS configuration
+// The Client is given its own transport so the shared one is left untouched.
 func (k *Client) TLSClientConfig(config *tls.Config) {
-	k.Transport.TLSClientConfig = config
-
+	k.Transport = newTransport(config, k.proxy())
 }
 
 // ProxyRequest set ProxyRequest Headers
@@ -339,6 +482,12 @@ func genProxyRequestHeader(r *http.Request) string {
 
 // End or EndBytes() must be called to execute the call otherwise it won't do a thing.
 func (k *Client) End(callback ...func(response Response, body string, errs []error)) (Response, string, []error) {
+	return k.EndContext(context.Background(), callback...)
+}
+
+// EndContext behaves like End but carries ctx through to the underlying http request,
+// allowing the caller to cancel an in-flight call or enforce a deadline.
+func (k *Client) EndContext(ctx context.Context, callback ...func(response Response, body string, errs []error)) (Response, string, []error) {
 	var bytesCallback []func(response Response, body []byte, errs []error)
 	if len(callback) > 0 {
 		bytesCallback = []func(response Response, body []byte, errs []error){
@@ -347,24 +496,80 @@ func (k *Client) End(callback ...func(response Response, body string, errs []err
 			},
 		}
 	}
-	resp, body, errs := k.EndBytes(bytesCallback...)
+	resp, body, errs := k.EndBytesContext(ctx, bytesCallback...)
 	bodyString := string(body)
 	return resp, bodyString, errs
 }
 
 // EndBytes should be used when you want the body as bytes.
 func (k *Client) EndBytes(callback ...func(response Response, body []byte, errs []error)) (Response, []byte, []error) {
+	return k.EndBytesContext(context.Background(), callback...)
+}
+
+// EndBytesContext behaves like EndBytes but carries ctx through to the underlying http request.
+func (k *Client) EndBytesContext(ctx context.Context, callback ...func(response Response, body []byte, errs []error)) (Response, []byte, []error) {
 	// check whether there is an error. if yes, return all errors
 	if len(k.Errors) != 0 {
 		return nil, nil, k.Errors
 	}
 
-	req, err := k.NewRequest()
-
+	// Send request
+	resp, err := k.send(ctx)
 	if err != nil {
 		k.Errors = append(k.Errors, err)
 		return nil, nil, k.Errors
 	}
+	defer resp.Body.Close()
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	// Reset resp.Body so it can be use again
+	resp.Body = ioutil.NopCloser(bytes.NewBuffer(body))
+	// deep copy response to give it to both return and callback func
+	respCallback := *resp
+	if len(callback) != 0 {
+		callback[0](&respCallback, body, k.Errors)
+	}
+	return resp, body, nil
+}
+
+// prepareRequest builds a complete, signed request from the Client's state.
+func (k *Client) prepareRequest(ctx context.Context) (*http.Request, error) {
+	req, err := k.buildRequest(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := k.authenticate(req); err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+// buildRequest builds a request from the Client's state, ready to be signed.
+// It is called once per attempt so every attempt carries a fresh signature.
+func (k *Client) buildRequest(ctx context.Context) (*http.Request, error) {
+	if k.body != nil {
+		if err := k.body.rewind(); err != nil {
+			return nil, err
+		}
+	}
+
+	req, err := k.NewRequest()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if k.body != nil && req.Body != nil {
+		req.ContentLength = k.body.size
+	}
+
+	req = req.WithContext(ctx)
+
+	if k.UserAgent != "" {
+		req.Header.Set("User-Agent", k.UserAgent)
+	}
 
 	for key, v := range k.Header {
 		req.Header.Set(key, v)
@@ -379,119 +584,162 @@ func (k *Client) EndBytes(callback ...func(response Response, body []byte, errs
 	}
 	req.URL.RawQuery = q.Encode()
 
-	// Sign Request
+	return req, nil
+}
+
+// authenticate signs req, or sets its basic auth credentials when signing is disabled
+func (k *Client) authenticate(req *http.Request) error {
 	if !k.Sign {
 		if k.BasicAuth != struct{ UserName, Password string }{} {
 			req.SetBasicAuth(k.BasicAuth.UserName, k.BasicAuth.Password)
 		}
-	} else {
-		k.signRequest(req, time.Now())
+		return nil
 	}
 
-	// Set Transport
-	certPool := *x509.NewCertPool()
-	certPool.AppendCertsFromPEM(RootCAs.AlphaSSLCA)
-	certPool.AppendCertsFromPEM(RootCAs.LetsEncryptCA)
+	return k.signRequest(req, k.now())
+}
 
-	tr := &http.Transport{
-		TLSClientConfig: &tls.Config{RootCAs: &certPool},
+// send performs the request through the middleware chain, retrying according to k.Retry.
+func (k *Client) send(ctx context.Context) (*http.Response, error) {
+	roundTrip, err := k.chain(k.httpClient())
+	if err != nil {
+		return nil, err
 	}
 
-	k.Client.Transport = tr
+	if k.BodyReader != nil {
+		body, err := newRequestBody(k.BodyReader)
+		if err != nil {
+			return nil, err
+		}
 
-	// Log details of this request
-	if k.Debug {
-		dump, logErr := httputil.DumpRequest(req, true)
-		k.check(logErr, dump)
+		k.body = body
+		defer func() { k.body = nil }()
 	}
 
-	// Send request
-	resp, err := k.Client.Do(req)
-	if err != nil {
-		k.Errors = append(k.Errors, err)
-		return nil, nil, k.Errors
-	}
-	defer resp.Body.Close()
+	for attempt := 1; ; attempt++ {
+		req, err := k.buildRequest(ctx)
+		if err != nil {
+			return nil, err
+		}
 
-	// Log details of this response
-	if k.Debug {
-		dump, err := httputil.DumpResponse(resp, true)
-		k.check(err, dump)
-	}
+		resp, err := roundTrip(req)
+		if abort, ok := err.(abortError); ok {
+			return nil, abort.err
+		}
 
-	body, _ := ioutil.ReadAll(resp.Body)
-	// Reset resp.Body so it can be use again
-	resp.Body = ioutil.NopCloser(bytes.NewBuffer(body))
-	// deep copy response to give it to both return and callback func
-	respCallback := *resp
-	if len(callback) != 0 {
-		callback[0](&respCallback, body, k.Errors)
-	}
-	return resp, body, nil
-}
+		wait, retry := k.Retry.next(attempt, req, resp, err, k.now())
+		if !retry {
+			return resp, err
+		}
 
-func (k *Client) check(e error, dump []byte) {
-	if e != nil {
-		k.Logger.Println("Error:", e)
-	} else {
-		k.Logger.Printf("HTTP Request: %s", string(dump))
-	}
+		if resp != nil {
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		k.Logger.Debugf("Retrying %s %s in %s (attempt %d)", req.Method, req.URL, wait, attempt+1)
 
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
 }
 
 //signRequest sets an authorization header with a signed string
 //t should be a time.Time.Now(). The authorization API will reject requests
 //older than 15 minutes
-func (k *Client) signRequest(req *http.Request, t time.Time) {
-	compliantDate := fmt.Sprintf(t.UTC().Format(time.RFC822Z))
-	signingString := k.Method + "\n"
+func (k *Client) signRequest(req *http.Request, t time.Time) error {
+	if k.SigningVersion == 2 {
+		return k.signRequestV2(req, t)
+	}
 
-	d, readErr := ioutil.ReadAll(strings.NewReader(k.RawString))
+	compliantDate := t.UTC().Format(time.RFC822Z)
+	u, _ := url.Parse(k.URL)
 
-	if readErr != nil {
-		k.Logger.Fatal(readErr)
+	c := canonicalRequest{
+		Method:     k.Method,
+		Path:       u.Path,
+		Date:       compliantDate,
+		HasBody:    hasBody(k.Method),
+		HasContext: signsContext(k.Method, req.URL.Path),
+		Context:    k.RoleUUID,
 	}
 
-	switch k.Method {
-	case POST, PUT, PATCH:
-		md5Sum := md5.Sum(d)
-		req.Header.Set("Content-MD5", fmt.Sprintf("%x", string(md5Sum[:16])))
+	if c.HasBody {
+		req.Header.Set("Content-MD5", k.contentMD5())
 
-		signingString += fmt.Sprintf("content-md5:%v\n", req.Header.Get("Content-MD5"))
-		signingString += fmt.Sprintf("content-type:%v\n", req.Header.Get("Content-Type"))
+		c.ContentMD5 = req.Header.Get("Content-MD5")
+		c.ContentType = req.Header.Get("Content-Type")
 	}
 
 	if k.ProxyRequestData != nil {
 		req.Header.Set("Proxy-Authorization", genProxyRequestHeader(k.ProxyRequestData))
-		signingString += fmt.Sprintf("proxy-authorization:%v\n", req.Header.Get("Proxy-Authorization"))
+		c.Proxied = true
+		c.ProxyAuthorization = req.Header.Get("Proxy-Authorization")
 
+		// The request's own context, when it is signed, replaces the forwarded one on the wire.
 		if k.ProxyRequestData.Header.Get("X-Kumoru-Context") != "" {
 			req.Header.Set("X-Kumoru-Context", k.ProxyRequestData.Header.Get("X-Kumoru-Context"))
-			signingString += fmt.Sprintf("x-kumoru-context:%v\n", req.Header.Get("x-kumoru-context"))
+			c.ForwardedContext = req.Header.Get("X-Kumoru-Context")
 		}
+	}
 
-		k.Logger.Debug("signingString", signingString)
+	if c.HasContext {
+		req.Header.Set("X-Kumoru-Context", k.RoleUUID)
 	}
 
-	u, _ := url.Parse(k.URL)
-	k.Logger.Debug("k.Url", k.URL)
+	req.Header.Set("X-Kumoru-Date", compliantDate)
+
+	signingString := c.String()
+	k.Logger.Debugf("signingString: %s", signingString)
 
-	//There is a chicken and egg problem retrieving account information the first time.
-	//The signing string cannot contain the context (RoleUUID) on the first request for account info.
-	//Since the signing string logic is general purpose, it's easiest to skip this header for GET to .../accounts/...
-	if strings.Contains(req.URL.Path, "/accounts/") == true && k.Method == "GET" {
-		//pass
+	signer := k.signer()
+	signature, err := signer.Sign(req.Context(), signingString)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", base64.StdEncoding.EncodeToString([]byte(signer.PublicToken()+":"+signature)))
+	return nil
+}
+
+// signRequestV2 sets the headers and authorization of a v2 signature, which also covers
+// the host and query string, hashes the body with SHA-256 and carries a nonce against replay
+func (k *Client) signRequestV2(req *http.Request, t time.Time) error {
+	req.Header.Set("X-Kumoru-Date", t.UTC().Format(time.RFC3339))
+	req.Header.Set(NonceHeader, newNonce())
+
+	if hasBody(req.Method) {
+		req.Header.Set(ContentSHA256Header, k.contentSHA256())
 	} else {
-		signingString += "x-kumoru-context:" + k.RoleUUID + "\n"
+		req.Header.Set(ContentSHA256Header, emptySHA256)
+	}
+
+	if signsContext(req.Method, req.URL.Path) {
 		req.Header.Set("X-Kumoru-Context", k.RoleUUID)
 	}
 
-	signingString += "x-kumoru-date:" + compliantDate + "\n" + u.Path
-	req.Header.Set("X-Kumoru-Date", compliantDate)
+	if k.ProxyRequestData != nil {
+		req.Header.Set("Proxy-Authorization", genProxyRequestHeader(k.ProxyRequestData))
 
-	h := hmac.New(sha256.New, []byte(k.Tokens.Private))
-	h.Write([]byte(signingString))
-	digest := fmt.Sprintf("%x", h.Sum(nil))
+		if k.ProxyRequestData.Header.Get("X-Kumoru-Context") != "" {
+			req.Header.Set(ForwardedContextHeader, k.ProxyRequestData.Header.Get("X-Kumoru-Context"))
+		}
+	}
+
+	signingString := newCanonicalRequestV2(req).String()
+	k.Logger.Debugf("signingString: %s", signingString)
+
+	signer := k.signer()
+	signature, err := signer.Sign(req.Context(), signingString)
+	if err != nil {
+		return err
+	}
 
-	req.Header.Set("Authorization", base64.StdEncoding.EncodeToString([]byte(k.Tokens.Public+":"+digest)))
+	req.Header.Set("Authorization", authorizationV2(signer.PublicToken(), signature))
+	return nil
 }
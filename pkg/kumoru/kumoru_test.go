@@ -17,6 +17,7 @@ limitations under the License.
 package kumoru
 
 import (
+	"context"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
@@ -204,6 +205,70 @@ func TestKumoruPut(t *testing.T) {
 	os.Clearenv()
 }
 
+// testing that a canceled context aborts an in-flight request
+func TestKumoruEndContext(t *testing.T) {
+	os.Clearenv()
+	os.Setenv("KUMORU_CONFIG", "example-cfg.ini")
+
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+
+	defer ts.Close()
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	k := New()
+	k.Get(ts.URL + "/v1/applications/")
+	resp, _, errs := k.EndContext(ctx)
+
+	if resp != nil {
+		t.Errorf("Expected nil response; got %v", resp.Status)
+	}
+	if len(errs) == 0 {
+		t.Fatal("Expected an error from a canceled request")
+	}
+	if ctx.Err() != context.DeadlineExceeded {
+		t.Errorf("Expected context deadline to be exceeded; got %v", ctx.Err())
+	}
+
+	os.Clearenv()
+}
+
+// testing that Clone keeps configuration but drops request state
+func TestKumoruClone(t *testing.T) {
+	k := &Client{
+		EndPoint: &Endpoints{Application: "https://application.example.com"},
+		Tokens:   &Ktokens{Public: "PUBLIC_TOKEN", Private: "PRIVATE_TOKEN"},
+		RoleUUID: "ROLE_UUID",
+	}
+	k.Header = map[string]string{"Custom-Header": "fookey"}
+	k.Method = GET
+
+	c := k.Clone()
+
+	if c.EndPoint.Application != k.EndPoint.Application {
+		t.Errorf("Expected application endpoint %q; got %q", k.EndPoint.Application, c.EndPoint.Application)
+	}
+	if c.Tokens.Public != "PUBLIC_TOKEN" || c.Tokens.Private != "PRIVATE_TOKEN" {
+		t.Errorf("Expected tokens to be copied; got %v", c.Tokens)
+	}
+	if c.RoleUUID != "ROLE_UUID" {
+		t.Errorf("Expected role %q; got %q", "ROLE_UUID", c.RoleUUID)
+	}
+	if len(c.Header) != 0 || c.Method != "" {
+		t.Errorf("Expected request state to be cleared; got %v %q", c.Header, c.Method)
+	}
+
+	c.EndPoint.Application = "https://other.example.com"
+	if k.EndPoint.Application != "https://application.example.com" {
+		t.Error("Expected clone endpoints to be independent of the original")
+	}
+}
+
 //Testing signing string logic
 func TestSignRequest(t *testing.T) {
 	cases := []struct {
@@ -0,0 +1,408 @@
+/*
+Copyright 2016 Kumoru.io
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kumorutest
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/kumoru/kumoru-sdk-go/pkg/kumoru"
+	"github.com/pborman/uuid"
+)
+
+func methodNotAllowed(w http.ResponseWriter) {
+	writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+}
+
+func notFound(w http.ResponseWriter, what string) {
+	writeError(w, http.StatusNotFound, "not_found", what+" not found")
+}
+
+// routeApplications serves /v1/applications/ and the deployments beneath it
+func (s *Server) routeApplications(w http.ResponseWriter, r *http.Request, id *kumoru.Identity, parts []string) {
+	switch {
+	case len(parts) == 0 && r.Method == "GET":
+		writePage(w, r, s.applications.list())
+	case len(parts) == 0 && r.Method == "POST":
+		s.createApplication(w, r, id)
+	case len(parts) == 1:
+		s.application(w, r, parts[0])
+	case len(parts) >= 2 && parts[1] == "deployments":
+		s.routeDeployments(w, r, parts[0], parts[2:])
+	default:
+		notFound(w, "endpoint")
+	}
+}
+
+func (s *Server) createApplication(w http.ResponseWriter, r *http.Request, id *kumoru.Identity) {
+	app := map[string]interface{}{}
+	if err := json.NewDecoder(r.Body).Decode(&app); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_json", err.Error())
+		return
+	}
+
+	if name, _ := app["name"].(string); name == "" {
+		writeError(w, http.StatusUnprocessableEntity, "validation_error", "name is required")
+		return
+	}
+
+	now := timestamp()
+	app["uuid"] = uuid.New()
+	app["created_at"] = now
+	app["updated_at"] = now
+	app["status"] = "pending"
+	app["deployment_token"] = uuid.New()
+	app["owner_uuid"] = id.RoleUUID
+
+	s.applications.put(app["uuid"].(string), app)
+	writeJSON(w, http.StatusCreated, app)
+}
+
+func (s *Server) application(w http.ResponseWriter, r *http.Request, appUUID string) {
+	app, ok := s.applications.get(appUUID)
+	if !ok {
+		notFound(w, "application")
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		writeJSON(w, http.StatusOK, app)
+	case "DELETE":
+		s.applications.remove(appUUID)
+		delete(s.deployments, appUUID)
+		w.WriteHeader(http.StatusNoContent)
+	case "PATCH":
+		if r.Header.Get("Content-Type") != "application/json-patch+json" {
+			writeError(w, http.StatusUnsupportedMediaType, "unsupported_media_type", "expected application/json-patch+json")
+			return
+		}
+
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_patch", err.Error())
+			return
+		}
+
+		patched, err := applyPatch(app, body)
+		if err != nil {
+			writeError(w, http.StatusUnprocessableEntity, "invalid_patch", err.Error())
+			return
+		}
+
+		patched["uuid"] = appUUID
+		patched["updated_at"] = timestamp()
+
+		s.applications.put(appUUID, patched)
+		writeJSON(w, http.StatusOK, patched)
+	default:
+		methodNotAllowed(w)
+	}
+}
+
+// routeDeployments serves /v1/applications/{uuid}/deployments/
+func (s *Server) routeDeployments(w http.ResponseWriter, r *http.Request, appUUID string, parts []string) {
+	app, ok := s.applications.get(appUUID)
+	if !ok {
+		notFound(w, "application")
+		return
+	}
+
+	deployments, ok := s.deployments[appUUID]
+	if !ok {
+		deployments = newCollection()
+		s.deployments[appUUID] = deployments
+	}
+
+	switch {
+	case len(parts) == 0 && r.Method == "GET":
+		writePage(w, r, deployments.list())
+	case len(parts) == 0 && r.Method == "POST":
+		if r.URL.Query().Get("deployment_token") != app["deployment_token"] {
+			writeError(w, http.StatusForbidden, "invalid_deployment_token", "deployment token does not match")
+			return
+		}
+
+		deployment := map[string]interface{}{
+			"application_uuid": appUUID,
+			"created_at":       timestamp(),
+			"environment":      app["environment"],
+			"image_id":         "",
+			"image_url":        app["image_url"],
+			"metadata":         app["metadata"],
+			"ports":            app["ports"],
+			"ssl_ports":        app["ssl_ports"],
+			"tag":              "latest",
+			"url":              app["url"],
+			"uuid":             uuid.New(),
+		}
+
+		deployments.put(deployment["uuid"].(string), deployment)
+		app["status"] = "deployed"
+		app["updated_at"] = timestamp()
+
+		writeJSON(w, http.StatusAccepted, deployment)
+	case len(parts) == 1 && r.Method == "GET":
+		deployment, ok := deployments.get(parts[0])
+		if !ok {
+			notFound(w, "deployment")
+			return
+		}
+		writeJSON(w, http.StatusOK, deployment)
+	default:
+		methodNotAllowed(w)
+	}
+}
+
+// routeLocations serves /v1/locations/[provider[/region]]
+func (s *Server) routeLocations(w http.ResponseWriter, r *http.Request, parts []string) {
+	if len(parts) > 2 {
+		notFound(w, "endpoint")
+		return
+	}
+
+	if r.Method == "GET" {
+		found := []map[string]interface{}{}
+		for _, l := range s.locations.list() {
+			if len(parts) > 0 && l["provider"] != parts[0] {
+				continue
+			}
+			if len(parts) > 1 && l["region"] != parts[1] {
+				continue
+			}
+			found = append(found, l)
+		}
+
+		writePage(w, r, found)
+		return
+	}
+
+	if len(parts) != 2 {
+		methodNotAllowed(w)
+		return
+	}
+
+	key := parts[0] + "/" + parts[1]
+
+	switch r.Method {
+	case "PUT":
+		if _, ok := s.locations.get(key); ok {
+			writeError(w, http.StatusConflict, "location_exists", "location already exists")
+			return
+		}
+
+		l := map[string]interface{}{
+			"kubernetes_api_url": "",
+			"provider":           parts[0],
+			"region":             parts[1],
+		}
+
+		s.locations.put(key, l)
+		writeJSON(w, http.StatusCreated, l)
+	case "DELETE":
+		if !s.locations.remove(key) {
+			notFound(w, "location")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		methodNotAllowed(w)
+	}
+}
+
+// routeSecrets serves /v1/secrets/
+func (s *Server) routeSecrets(w http.ResponseWriter, r *http.Request, parts []string) {
+	switch {
+	case len(parts) == 0 && r.Method == "GET":
+		writePage(w, r, s.secrets.list())
+	case len(parts) == 0 && r.Method == "POST":
+		if err := r.ParseForm(); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_form", err.Error())
+			return
+		}
+
+		if r.PostForm.Get("value") == "" {
+			writeError(w, http.StatusUnprocessableEntity, "validation_error", "value is required")
+			return
+		}
+
+		labels := r.PostForm["labels"]
+		if labels == nil {
+			labels = []string{}
+		}
+
+		now := timestamp()
+		secret := map[string]interface{}{
+			"created_at": now,
+			"labels":     labels,
+			"updated_at": now,
+			"uuid":       uuid.New(),
+			"value":      r.PostForm.Get("value"),
+		}
+
+		s.secrets.put(secret["uuid"].(string), secret)
+		writeJSON(w, http.StatusCreated, secret)
+	case len(parts) == 1 && r.Method == "GET":
+		secret, ok := s.secrets.get(parts[0])
+		if !ok {
+			notFound(w, "secret")
+			return
+		}
+		writeJSON(w, http.StatusOK, secret)
+	default:
+		methodNotAllowed(w)
+	}
+}
+
+// createAccount serves the unsigned PUT /v1/accounts/{email}
+func (s *Server) createAccount(w http.ResponseWriter, r *http.Request, email string) {
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_form", err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.accounts[email]; ok {
+		writeError(w, http.StatusConflict, "account_exists", "account already exists")
+		return
+	}
+
+	if r.PostForm.Get("password") == "" {
+		writeError(w, http.StatusUnprocessableEntity, "validation_error", "password is required")
+		return
+	}
+
+	now := timestamp()
+	a := &account{
+		password: r.PostForm.Get("password"),
+		fields: map[string]interface{}{
+			"created_at": now,
+			"email":      email,
+			"given_name": r.PostForm.Get("given_name"),
+			"role_uuid":  uuid.New(),
+			"surname":    r.PostForm.Get("surname"),
+			"updated_at": now,
+		},
+	}
+
+	s.accounts[email] = a
+	writeJSON(w, http.StatusCreated, a.fields)
+}
+
+func (s *Server) showAccount(w http.ResponseWriter, r *http.Request, parts []string) {
+	if len(parts) != 1 || r.Method != "GET" {
+		methodNotAllowed(w)
+		return
+	}
+
+	a, ok := s.accounts[parts[0]]
+	if !ok {
+		notFound(w, "account")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, a.fields)
+}
+
+// resetPassword serves the unsigned GET /v1/accounts/{email}/password/resets/
+func (s *Server) resetPassword(w http.ResponseWriter, r *http.Request, email string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.accounts[email]; !ok {
+		notFound(w, "account")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// createToken serves PUT /v1/tokens/{public}, authenticated with the account's email and password
+func (s *Server) createToken(w http.ResponseWriter, r *http.Request, parts []string) {
+	if len(parts) != 1 || parts[0] == "" || r.Method != "PUT" {
+		methodNotAllowed(w)
+		return
+	}
+
+	email, password, ok := r.BasicAuth()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, exists := s.accounts[email]
+	if !ok || !exists || a.password != password {
+		writeError(w, http.StatusUnauthorized, "invalid_credentials", "email or password is incorrect")
+		return
+	}
+
+	if _, taken := s.tokens[parts[0]]; taken {
+		writeError(w, http.StatusConflict, "token_exists", "token already exists")
+		return
+	}
+
+	private := uuid.New()
+	s.tokens[parts[0]] = private
+
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(http.StatusCreated)
+	w.Write([]byte(private))
+}
+
+// findResources serves GET /v1/resources/?select_by=type=T,action=A[,uuid=U]
+func (s *Server) findResources(w http.ResponseWriter, r *http.Request, id *kumoru.Identity) {
+	if r.Method != "GET" {
+		methodNotAllowed(w)
+		return
+	}
+
+	selectBy := map[string]string{}
+	for _, term := range strings.Split(r.URL.Query().Get("select_by"), ",") {
+		kv := strings.SplitN(term, "=", 2)
+		if len(kv) == 2 {
+			selectBy[kv[0]] = kv[1]
+		}
+	}
+
+	var items []map[string]interface{}
+	switch selectBy["type"] {
+	case "application":
+		items = s.applications.list()
+	case "secret":
+		items = s.secrets.list()
+	}
+
+	resources := []map[string]interface{}{}
+	for _, item := range items {
+		if selectBy["uuid"] != "" && item["uuid"] != selectBy["uuid"] {
+			continue
+		}
+
+		resources = append(resources, map[string]interface{}{
+			"context":    id.RoleUUID,
+			"created_at": item["created_at"],
+			"identifier": item["uuid"],
+			"type":       selectBy["type"],
+			"updated_at": item["updated_at"],
+		})
+	}
+
+	writeJSON(w, http.StatusOK, resources)
+}
@@ -0,0 +1,283 @@
+/*
+Copyright 2016 Kumoru.io
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kumorutest
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// patchOperation is one operation of an RFC 6902 JSON Patch
+type patchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// applyPatch returns a copy of doc with the JSON Patch in patch applied.
+// doc is left untouched if any operation fails.
+func applyPatch(doc map[string]interface{}, patch []byte) (map[string]interface{}, error) {
+	var ops []patchOperation
+	if err := json.Unmarshal(patch, &ops); err != nil {
+		return nil, err
+	}
+
+	var root interface{}
+	if err := deepCopy(doc, &root); err != nil {
+		return nil, err
+	}
+
+	for _, op := range ops {
+		var err error
+		if root, err = op.apply(root); err != nil {
+			return nil, fmt.Errorf("%s %s: %s", op.Op, op.Path, err)
+		}
+	}
+
+	patched, ok := root.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("patched document is not an object")
+	}
+
+	return patched, nil
+}
+
+func (op patchOperation) apply(root interface{}) (interface{}, error) {
+	path, err := parsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	var value interface{}
+	switch op.Op {
+	case "add", "replace", "test":
+		if op.Value == nil {
+			return nil, fmt.Errorf("missing value")
+		}
+		if err := json.Unmarshal(op.Value, &value); err != nil {
+			return nil, err
+		}
+	}
+
+	switch op.Op {
+	case "add":
+		return put(root, path, value, true)
+	case "replace":
+		return put(root, path, value, false)
+	case "remove":
+		return remove(root, path)
+	case "test":
+		current, err := get(root, path)
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(current, value) {
+			return nil, fmt.Errorf("test failed")
+		}
+		return root, nil
+	case "move", "copy":
+		from, err := parsePointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+
+		current, err := get(root, from)
+		if err != nil {
+			return nil, err
+		}
+
+		if op.Op == "move" {
+			if root, err = remove(root, from); err != nil {
+				return nil, err
+			}
+		} else if err := deepCopy(current, &current); err != nil {
+			return nil, err
+		}
+
+		return put(root, path, current, true)
+	}
+
+	return nil, fmt.Errorf("unsupported operation")
+}
+
+// parsePointer splits an RFC 6901 JSON Pointer into its unescaped reference tokens
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid pointer %q", pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.Replace(strings.Replace(t, "~1", "/", -1), "~0", "~", -1)
+	}
+
+	return tokens, nil
+}
+
+func arrayIndex(token string, length int) (int, error) {
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || i >= length {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	return i, nil
+}
+
+func get(node interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		switch n := node.(type) {
+		case map[string]interface{}:
+			child, ok := n[token]
+			if !ok {
+				return nil, fmt.Errorf("%q does not exist", token)
+			}
+			node = child
+		case []interface{}:
+			i, err := arrayIndex(token, len(n))
+			if err != nil {
+				return nil, err
+			}
+			node = n[i]
+		default:
+			return nil, fmt.Errorf("%q does not exist", token)
+		}
+	}
+
+	return node, nil
+}
+
+// put sets the value at path, returning the possibly reallocated node.
+// insert allows new object members and shifts array elements up, as "add" does.
+func put(node interface{}, path []string, value interface{}, insert bool) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	token := path[0]
+
+	switch n := node.(type) {
+	case map[string]interface{}:
+		child, ok := n[token]
+		if len(path) == 1 {
+			if !ok && !insert {
+				return nil, fmt.Errorf("%q does not exist", token)
+			}
+			n[token] = value
+			return n, nil
+		}
+		if !ok {
+			return nil, fmt.Errorf("%q does not exist", token)
+		}
+
+		child, err := put(child, path[1:], value, insert)
+		if err != nil {
+			return nil, err
+		}
+		n[token] = child
+		return n, nil
+	case []interface{}:
+		if len(path) == 1 && insert {
+			if token == "-" {
+				return append(n, value), nil
+			}
+
+			i, err := arrayIndex(token, len(n)+1)
+			if err != nil {
+				return nil, err
+			}
+
+			n = append(n, nil)
+			copy(n[i+1:], n[i:])
+			n[i] = value
+			return n, nil
+		}
+
+		i, err := arrayIndex(token, len(n))
+		if err != nil {
+			return nil, err
+		}
+
+		child, err := put(n[i], path[1:], value, insert)
+		if err != nil {
+			return nil, err
+		}
+		n[i] = child
+		return n, nil
+	}
+
+	return nil, fmt.Errorf("%q does not exist", token)
+}
+
+// remove deletes the value at path, returning the possibly reallocated node
+func remove(node interface{}, path []string) (interface{}, error) {
+	if len(path) == 0 {
+		return nil, fmt.Errorf("cannot remove the whole document")
+	}
+
+	token := path[0]
+
+	switch n := node.(type) {
+	case map[string]interface{}:
+		child, ok := n[token]
+		if !ok {
+			return nil, fmt.Errorf("%q does not exist", token)
+		}
+		if len(path) == 1 {
+			delete(n, token)
+			return n, nil
+		}
+
+		child, err := remove(child, path[1:])
+		if err != nil {
+			return nil, err
+		}
+		n[token] = child
+		return n, nil
+	case []interface{}:
+		i, err := arrayIndex(token, len(n))
+		if err != nil {
+			return nil, err
+		}
+		if len(path) == 1 {
+			return append(n[:i], n[i+1:]...), nil
+		}
+
+		child, err := remove(n[i], path[1:])
+		if err != nil {
+			return nil, err
+		}
+		n[i] = child
+		return n, nil
+	}
+
+	return nil, fmt.Errorf("%q does not exist", token)
+}
+
+// deepCopy copies src into dst by way of its JSON encoding
+func deepCopy(src interface{}, dst *interface{}) error {
+	b, err := json.Marshal(src)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, dst)
+}
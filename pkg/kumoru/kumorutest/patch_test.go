@@ -0,0 +1,73 @@
+/*
+Copyright 2016 Kumoru.io
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kumorutest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyPatch(t *testing.T) {
+	doc := map[string]interface{}{
+		"name":  "web",
+		"ports": []interface{}{"80", "443"},
+		"env":   map[string]interface{}{"A": "1"},
+	}
+
+	cases := []struct {
+		patch    string
+		expected map[string]interface{}
+		err      bool
+	}{
+		{
+			patch:    `[{"op":"replace","path":"/name","value":"api"}]`,
+			expected: map[string]interface{}{"name": "api", "ports": []interface{}{"80", "443"}, "env": map[string]interface{}{"A": "1"}},
+		}, {
+			patch:    `[{"op":"add","path":"/ports/1","value":"8080"},{"op":"remove","path":"/env/A"}]`,
+			expected: map[string]interface{}{"name": "web", "ports": []interface{}{"80", "8080", "443"}, "env": map[string]interface{}{}},
+		}, {
+			patch:    `[{"op":"add","path":"/ports/-","value":"22"},{"op":"copy","from":"/name","path":"/env/B"}]`,
+			expected: map[string]interface{}{"name": "web", "ports": []interface{}{"80", "443", "22"}, "env": map[string]interface{}{"A": "1", "B": "web"}},
+		}, {
+			patch:    `[{"op":"move","from":"/env/A","path":"/a~1b"}]`,
+			expected: map[string]interface{}{"name": "web", "ports": []interface{}{"80", "443"}, "env": map[string]interface{}{}, "a/b": "1"},
+		}, {
+			patch: `[{"op":"test","path":"/name","value":"other"}]`,
+			err:   true,
+		}, {
+			patch: `[{"op":"replace","path":"/missing","value":1}]`,
+			err:   true,
+		}, {
+			patch: `[{"op":"remove","path":"/ports/5"}]`,
+			err:   true,
+		},
+	}
+
+	for _, c := range cases {
+		result, err := applyPatch(doc, []byte(c.patch))
+		if c.err {
+			assert.NotNil(t, err, c.patch)
+			continue
+		}
+
+		assert.Nil(t, err, c.patch)
+		assert.Equal(t, c.expected, result, c.patch)
+	}
+
+	assert.Equal(t, "web", doc["name"], "the original document is not modified")
+}
@@ -0,0 +1,386 @@
+/*
+Copyright 2016 Kumoru.io
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package kumorutest provides an in-memory Kumoru API for testing code built on the SDK.
+//
+// A Server answers the v1 applications, deployments, locations, secrets, accounts, tokens and resources
+// endpoints, checks request signatures the same way the real services do and can be told to fail or slow down:
+//
+// s := kumorutest.NewServer()
+// defer s.Close()
+//
+// app, _, err := application.NewService(s.Client()).Create(ctx, &application.Application{Name: "web"})
+package kumorutest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kumoru/kumoru-sdk-go/pkg/kumoru"
+	"github.com/pborman/uuid"
+)
+
+// Server is an in-memory Kumoru API listening on a local address
+type Server struct {
+	*httptest.Server
+
+	// PublicToken, PrivateToken and RoleUUID are the credentials used by Client.
+	PublicToken  string
+	PrivateToken string
+	RoleUUID     string
+
+	mu           sync.Mutex
+	accounts     map[string]*account
+	applications *collection
+	deployments  map[string]*collection
+	locations    *collection
+	secrets      *collection
+	tokens       map[string]string
+	verifier     *kumoru.Verifier
+	faults       []*Fault
+	latency      time.Duration
+}
+
+type account struct {
+	password string
+	fields   map[string]interface{}
+}
+
+// Fault describes a failure to inject into requests matching Method and Path
+type Fault struct {
+	// Method matches any method when empty.
+	Method string
+	// Path is a prefix of the request path; empty matches every path.
+	Path string
+	// Status and Body are written instead of the normal response when Status is non-zero.
+	// Body defaults to a JSON error naming the status.
+	Status int
+	Body   string
+	Header http.Header
+	// Latency delays the matching requests.
+	Latency time.Duration
+	// Drop closes the connection without writing a response.
+	Drop bool
+	// Times limits how many requests the fault applies to; zero applies it to every request.
+	Times int
+}
+
+// NewServer starts and returns a new Server with one set of credentials.
+// The caller should call Close when finished, to shut it down.
+func NewServer() *Server {
+	s := &Server{
+		PublicToken:  uuid.New(),
+		PrivateToken: uuid.New(),
+		RoleUUID:     uuid.New(),
+		accounts:     make(map[string]*account),
+		applications: newCollection(),
+		deployments:  make(map[string]*collection),
+		locations:    newCollection(),
+		secrets:      newCollection(),
+		tokens:       make(map[string]string),
+	}
+
+	s.tokens[s.PublicToken] = s.PrivateToken
+	s.verifier = kumoru.NewVerifier(s.lookup)
+	s.Server = httptest.NewServer(s)
+
+	return s
+}
+
+// Client returns a kumoru.Client with every endpoint pointing at s and signing with s's credentials.
+// Further options are applied after those; Client panics if they leave the client invalid.
+func (s *Server) Client(opts ...kumoru.Option) *kumoru.Client {
+	opts = append([]kumoru.Option{
+		kumoru.WithEndpoints(kumoru.Endpoints{
+			Application:   s.URL,
+			Authorization: s.URL,
+			Location:      s.URL,
+		}),
+		kumoru.WithCredentials(s.PublicToken, s.PrivateToken),
+		kumoru.WithRole(s.RoleUUID),
+	}, opts...)
+
+	k, err := kumoru.NewClient(opts...)
+	if err != nil {
+		panic("kumorutest: " + err.Error())
+	}
+
+	return k
+}
+
+// AddAccount registers an account which can sign in with email and password, e.g. to request tokens
+func (s *Server) AddAccount(email, password string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := timestamp()
+	s.accounts[email] = &account{
+		password: password,
+		fields: map[string]interface{}{
+			"created_at": now,
+			"email":      email,
+			"role_uuid":  s.RoleUUID,
+			"updated_at": now,
+		},
+	}
+}
+
+// AddToken registers another public and private token pair
+func (s *Server) AddToken(public, private string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tokens[public] = private
+}
+
+// InjectFault adds f to the faults checked for each request. The first matching fault is used.
+func (s *Server) InjectFault(f Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.faults = append(s.faults, &f)
+}
+
+// ClearFaults removes every injected fault
+func (s *Server) ClearFaults() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.faults = nil
+}
+
+// SetLatency delays every response by d
+func (s *Server) SetLatency(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.latency = d
+}
+
+// ServeHTTP routes a request to the handler for its endpoint
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	f := s.matchFault(r)
+	latency := s.latency
+	s.mu.Unlock()
+
+	if f != nil {
+		latency += f.Latency
+	}
+	time.Sleep(latency)
+
+	if f != nil && f.Drop {
+		if hj, ok := w.(http.Hijacker); ok {
+			if conn, _, err := hj.Hijack(); err == nil {
+				conn.Close()
+				return
+			}
+		}
+	}
+
+	if f != nil && f.Status != 0 {
+		for key, values := range f.Header {
+			w.Header()[key] = values
+		}
+
+		if f.Body == "" {
+			writeError(w, f.Status, "injected_fault", http.StatusText(f.Status))
+			return
+		}
+
+		w.WriteHeader(f.Status)
+		w.Write([]byte(f.Body))
+		return
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) < 2 || parts[0] != "v1" {
+		writeError(w, http.StatusNotFound, "not_found", "no such endpoint")
+		return
+	}
+
+	// Creating an account, resetting a password and requesting tokens are not signed.
+	switch {
+	case parts[1] == "accounts" && len(parts) == 3 && r.Method == "PUT":
+		s.createAccount(w, r, parts[2])
+		return
+	case parts[1] == "accounts" && len(parts) == 5 && parts[3] == "password" && parts[4] == "resets":
+		s.resetPassword(w, r, parts[2])
+		return
+	case parts[1] == "tokens":
+		s.createToken(w, r, parts[2:])
+		return
+	}
+
+	s.verifier.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, _ := kumoru.IdentityFromContext(r.Context())
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		switch parts[1] {
+		case "applications":
+			s.routeApplications(w, r, id, parts[2:])
+		case "locations":
+			s.routeLocations(w, r, parts[2:])
+		case "secrets":
+			s.routeSecrets(w, r, parts[2:])
+		case "accounts":
+			s.showAccount(w, r, parts[2:])
+		case "resources":
+			s.findResources(w, r, id)
+		default:
+			writeError(w, http.StatusNotFound, "not_found", "no such endpoint")
+		}
+	})).ServeHTTP(w, r)
+}
+
+// matchFault returns the first fault matching r, using up one of its Times
+func (s *Server) matchFault(r *http.Request) *Fault {
+	for i, f := range s.faults {
+		if f.Method != "" && f.Method != r.Method {
+			continue
+		}
+		if !strings.HasPrefix(r.URL.Path, f.Path) {
+			continue
+		}
+
+		if f.Times > 0 {
+			f.Times--
+			if f.Times == 0 {
+				s.faults = append(s.faults[:i], s.faults[i+1:]...)
+			}
+		}
+
+		return f
+	}
+
+	return nil
+}
+
+func (s *Server) lookup(public string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	private, ok := s.tokens[public]
+	if !ok {
+		return "", kumoru.ErrUnknownKey
+	}
+
+	return private, nil
+}
+
+// collection keeps JSON objects by identifier in the order they were added
+type collection struct {
+	order []string
+	items map[string]map[string]interface{}
+}
+
+func newCollection() *collection {
+	return &collection{items: make(map[string]map[string]interface{})}
+}
+
+func (c *collection) get(id string) (map[string]interface{}, bool) {
+	item, ok := c.items[id]
+	return item, ok
+}
+
+func (c *collection) put(id string, item map[string]interface{}) {
+	if _, ok := c.items[id]; !ok {
+		c.order = append(c.order, id)
+	}
+	c.items[id] = item
+}
+
+func (c *collection) remove(id string) bool {
+	if _, ok := c.items[id]; !ok {
+		return false
+	}
+
+	delete(c.items, id)
+	for i, v := range c.order {
+		if v == id {
+			c.order = append(c.order[:i], c.order[i+1:]...)
+			break
+		}
+	}
+
+	return true
+}
+
+func (c *collection) list() []map[string]interface{} {
+	items := make([]map[string]interface{}, 0, len(c.order))
+	for _, id := range c.order {
+		items = append(items, c.items[id])
+	}
+	return items
+}
+
+// Helpers
+func timestamp() string {
+	return time.Now().UTC().Format(time.RFC3339Nano)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal_error", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// writePage writes the page of items selected by the limit and cursor parameters of r, with a Link
+// to the next page if there is one. Without a limit every item is written.
+func writePage(w http.ResponseWriter, r *http.Request, items []map[string]interface{}) {
+	q := r.URL.Query()
+
+	limit, err := strconv.Atoi(q.Get(kumoru.LimitParameter))
+	if err != nil || limit <= 0 {
+		writeJSON(w, http.StatusOK, items)
+		return
+	}
+
+	start, _ := strconv.Atoi(q.Get(kumoru.CursorParameter))
+	if start < 0 || start > len(items) {
+		start = len(items)
+	}
+
+	end := start + limit
+	if end < len(items) {
+		q.Set(kumoru.CursorParameter, strconv.Itoa(end))
+		next := *r.URL
+		next.RawQuery = q.Encode()
+		w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, next.RequestURI()))
+	} else {
+		end = len(items)
+	}
+
+	writeJSON(w, http.StatusOK, items[start:end])
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, map[string]string{"code": code, "message": message})
+}
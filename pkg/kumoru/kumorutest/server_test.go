@@ -0,0 +1,320 @@
+/*
+Copyright 2016 Kumoru.io
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kumorutest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/kumoru/kumoru-sdk-go/pkg/kumoru"
+	"github.com/kumoru/kumoru-sdk-go/pkg/service/application"
+	"github.com/kumoru/kumoru-sdk-go/pkg/service/application/deployments"
+	"github.com/kumoru/kumoru-sdk-go/pkg/service/authorization"
+	"github.com/kumoru/kumoru-sdk-go/pkg/service/authorization/resources"
+	"github.com/kumoru/kumoru-sdk-go/pkg/service/authorization/secrets"
+	"github.com/kumoru/kumoru-sdk-go/pkg/service/location"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplicationLifecycle(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	ctx := context.Background()
+	svc := application.NewService(s.Client())
+
+	app, _, err := svc.Create(ctx, &application.Application{Name: "web", ImageURL: "registry/web"})
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.NotEmpty(t, app.UUID)
+	assert.Equal(t, "pending", app.Status)
+	assert.Equal(t, s.RoleUUID, app.OwnerUUID)
+
+	patched := *app
+	patched.Name = "web-2"
+	patched.Environment = map[string]string{"PORT": "80"}
+
+	result, _, err := svc.Patch(ctx, app, &patched)
+	if assert.Nil(t, err) {
+		assert.Equal(t, "web-2", result.Name)
+		assert.Equal(t, "80", result.Environment["PORT"])
+		assert.Equal(t, app.UUID, result.UUID)
+	}
+
+	_, _, err = svc.Deploy(ctx, result)
+	assert.Nil(t, err)
+
+	depSvc := deployments.NewService(s.Client())
+	list, _, err := depSvc.List(ctx, app.UUID)
+	if assert.Nil(t, err) && assert.Len(t, *list, 1) {
+		d, _, err := depSvc.Show(ctx, app.UUID, (*list)[0].Uuid)
+		assert.Nil(t, err)
+		assert.Equal(t, "80", d.Environment["PORT"])
+	}
+
+	shown, _, err := svc.Show(ctx, &application.Application{UUID: app.UUID})
+	if assert.Nil(t, err) {
+		assert.Equal(t, "deployed", shown.Status)
+	}
+
+	_, _, err = svc.Delete(ctx, app)
+	assert.Nil(t, err)
+
+	_, _, err = svc.Show(ctx, &application.Application{UUID: app.UUID})
+	assert.True(t, kumoru.IsNotFound(err))
+}
+
+func TestApplicationValidation(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	_, _, err := application.NewService(s.Client()).Create(context.Background(), &application.Application{})
+	assert.True(t, kumoru.IsValidation(err))
+
+	app := &application.Application{Name: "web"}
+	application.NewService(s.Client()).Create(context.Background(), app)
+
+	app.DeploymentToken = "wrong"
+	_, _, err = application.NewService(s.Client()).Deploy(context.Background(), app)
+	assert.True(t, kumoru.IsForbidden(err))
+}
+
+func TestSigningV2(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	svc := application.NewService(s.Client(kumoru.WithSigningVersion(2)))
+
+	app, _, err := svc.Create(context.Background(), &application.Application{Name: "web"})
+	if assert.Nil(t, err) {
+		_, _, err = svc.Deploy(context.Background(), app)
+		assert.Nil(t, err, "the deployment_token query parameter is signed")
+	}
+}
+
+func TestReplayRejected(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	// Send each signed request twice, returning the response to the copy.
+	replay := func(next kumoru.RoundTripFunc) kumoru.RoundTripFunc {
+		return func(req *http.Request) (*http.Response, error) {
+			resp, err := next(req)
+			if err != nil {
+				return nil, err
+			}
+			resp.Body.Close()
+			return next(req)
+		}
+	}
+
+	k := s.Client(kumoru.WithSigningVersion(2), kumoru.WithMiddleware("replay", replay))
+	_, _, err := application.NewService(k).List(context.Background())
+	assert.True(t, kumoru.IsUnauthorized(err), "a replayed request is rejected")
+}
+
+func TestDryRun(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	ctx := context.Background()
+	app, _, err := application.NewService(s.Client()).Create(ctx, &application.Application{Name: "web"})
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	var out bytes.Buffer
+	svc := application.NewService(s.Client(kumoru.WithDryRun(&out)))
+
+	patched := *app
+	patched.Name = "web-2"
+	patched.Environment = map[string]string{"DB_PASSWORD": "hunter2"}
+	patched.Certificates.PrivateKey = "PRIVATE KEY"
+	result, resp, err := svc.Patch(ctx, app, &patched)
+	if assert.Nil(t, err) {
+		assert.True(t, kumoru.IsDryRun(resp))
+		assert.Equal(t, "web-2", result.Name)
+	}
+	assert.Contains(t, out.String(), `"path":"/name","value":"web-2"`, "the computed patch is shown")
+	assert.NotContains(t, out.String(), "hunter2")
+	assert.NotContains(t, out.String(), "PRIVATE KEY")
+
+	_, _, err = svc.Delete(ctx, app)
+	assert.Nil(t, err)
+
+	locations := location.NewService(s.Client(kumoru.WithDryRun(nil)))
+	resp, err = locations.Delete(ctx, &location.Location{Provider: "amazon", Region: "us-east-1"})
+	assert.Nil(t, err)
+	assert.True(t, kumoru.IsDryRun(resp))
+
+	shown, _, err := svc.Show(ctx, &application.Application{UUID: app.UUID})
+	if assert.Nil(t, err) {
+		assert.Equal(t, "web", shown.Name, "nothing was changed")
+	}
+}
+
+func TestPagination(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	ctx := context.Background()
+	svc := application.NewService(s.Client())
+	for i := 0; i < 5; i++ {
+		svc.Create(ctx, &application.Application{Name: fmt.Sprintf("web-%d", i)})
+	}
+
+	var names []string
+	it := svc.Iterate(kumoru.PageOptions{PageSize: 2})
+	for it.Next(ctx) {
+		names = append(names, it.Application().Name)
+	}
+	assert.Nil(t, it.Err())
+	assert.Equal(t, []string{"web-0", "web-1", "web-2", "web-3", "web-4"}, names)
+
+	names = nil
+	it = svc.Iterate(kumoru.PageOptions{PageSize: 2, Limit: 3})
+	for it.Next(ctx) {
+		names = append(names, it.Application().Name)
+	}
+	assert.Equal(t, []string{"web-0", "web-1", "web-2"}, names)
+}
+
+func TestLocations(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	ctx := context.Background()
+	svc := location.NewService(s.Client())
+
+	_, _, err := svc.Create(ctx, &location.Location{Provider: "amazon", Region: "us-east-1"})
+	assert.Nil(t, err)
+
+	_, _, err = svc.Create(ctx, &location.Location{Provider: "amazon", Region: "us-east-1"})
+	assert.True(t, kumoru.IsConflict(err))
+
+	body, _, err := svc.Find(ctx, &location.Location{Provider: "amazon"})
+	assert.Nil(t, err)
+	assert.Contains(t, body, `"region":"us-east-1"`)
+
+	_, err = svc.Delete(ctx, &location.Location{Provider: "amazon", Region: "us-east-1"})
+	assert.Nil(t, err)
+	_, err = svc.Delete(ctx, &location.Location{Provider: "amazon", Region: "us-east-1"})
+	assert.True(t, kumoru.IsNotFound(err))
+}
+
+func TestSecretsAndResources(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	ctx := context.Background()
+	svc := secrets.NewService(s.Client())
+
+	secret, _, err := svc.Create(ctx, &secrets.Secret{Value: "hunter2", Labels: []string{"db"}})
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.NotEmpty(t, secret.Uuid)
+
+	shown, _, err := svc.Show(ctx, &secret.Uuid)
+	if assert.Nil(t, err) {
+		assert.Equal(t, "hunter2", shown.Value)
+		assert.Equal(t, []string{"db"}, shown.Labels)
+	}
+
+	list, _, err := svc.List(ctx)
+	assert.Nil(t, err)
+	assert.Len(t, list, 1)
+
+	_, body, err := resources.NewService(s.Client()).Find(ctx, "secret", "read", secret.Uuid, nil)
+	assert.Nil(t, err)
+	assert.Contains(t, body, secret.Uuid)
+}
+
+func TestAccountsAndTokens(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	ctx := context.Background()
+	svc := authorization.NewService(s.Client(kumoru.WithoutCredentials()))
+
+	_, _, err := svc.CreateAcct(ctx, &authorization.Account{Email: "dev@example.com", GivenName: "Dev"}, "secret")
+	assert.Nil(t, err)
+
+	_, _, _, err = svc.GetTokens(ctx, "dev@example.com", "wrong")
+	assert.True(t, kumoru.IsUnauthorized(err))
+
+	public, _, private, err := svc.GetTokens(ctx, "dev@example.com", "secret")
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	account, _, err := authorization.NewService(s.Client(kumoru.WithCredentials(public, private))).Show(ctx, &authorization.Account{Email: "dev@example.com"})
+	if assert.Nil(t, err) {
+		assert.Equal(t, "Dev", account.GivenName)
+	}
+
+	_, _, err = svc.ResetPassword(ctx, &authorization.Account{Email: "dev@example.com"})
+	assert.Nil(t, err)
+}
+
+func TestSignatureRequired(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	k := s.Client(kumoru.WithCredentials(s.PublicToken, "not the private token"))
+	_, _, err := application.NewService(k).List(context.Background())
+	assert.True(t, kumoru.IsUnauthorized(err))
+}
+
+func TestFaults(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	ctx := context.Background()
+	policy := kumoru.DefaultRetryPolicy()
+	policy.MinBackoff = time.Millisecond
+
+	s.InjectFault(Fault{Method: "GET", Path: "/v1/applications/", Status: 503, Times: 2})
+	_, _, err := application.NewService(s.Client(kumoru.WithRetryPolicy(policy))).List(ctx)
+	assert.Nil(t, err, "retried past the injected failures")
+
+	s.InjectFault(Fault{Path: "/v1/secrets/", Status: 500, Body: `{"code":"boom"}`})
+	_, _, err = secrets.NewService(s.Client()).List(ctx)
+	if assert.True(t, kumoru.IsServerError(err)) {
+		assert.Equal(t, "boom", err.(*kumoru.APIError).Code)
+	}
+
+	s.ClearFaults()
+	_, _, err = secrets.NewService(s.Client()).List(ctx)
+	assert.Nil(t, err)
+
+	s.InjectFault(Fault{Drop: true})
+	_, _, err = secrets.NewService(s.Client()).List(ctx)
+	assert.NotNil(t, err)
+	s.ClearFaults()
+
+	s.SetLatency(50 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, _, err = secrets.NewService(s.Client()).List(ctx)
+	assert.NotNil(t, err)
+}
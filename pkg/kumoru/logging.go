@@ -0,0 +1,370 @@
+/*
+Copyright 2016 Kumoru.io
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kumoru
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Logger receives the log output of a Client. *logrus.Logger implements it;
+// other logging libraries need only a small adapter.
+type Logger interface {
+	Debugf(format string, args ...interface{})
+	Infof(format string, args ...interface{})
+	Warnf(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+// RequestLogger is implemented by a Logger which accepts structured request entries.
+// Other loggers are given each entry as a single formatted line.
+type RequestLogger interface {
+	LogRequest(entry RequestLog)
+}
+
+// RequestLog describes one attempt of a request made with debugging enabled.
+// Headers, the URL and bodies have been passed through the Client's Redactor.
+type RequestLog struct {
+	Method         string
+	URL            string
+	Status         int
+	Duration       time.Duration
+	RequestID      string
+	Error          string
+	RequestHeader  http.Header
+	RequestBody    string
+	ResponseHeader http.Header
+	ResponseBody   string
+}
+
+// Fields returns e as key/value pairs for structured loggers
+func (e RequestLog) Fields() map[string]interface{} {
+	fields := map[string]interface{}{
+		"method":      e.Method,
+		"url":         e.URL,
+		"status":      e.Status,
+		"duration_ms": e.Duration.Seconds() * 1000,
+		"request_id":  e.RequestID,
+	}
+
+	if e.Error != "" {
+		fields["error"] = e.Error
+	}
+	if len(e.RequestHeader) > 0 {
+		fields["request_headers"] = e.RequestHeader
+	}
+	if e.RequestBody != "" {
+		fields["request_body"] = e.RequestBody
+	}
+	if len(e.ResponseHeader) > 0 {
+		fields["response_headers"] = e.ResponseHeader
+	}
+	if e.ResponseBody != "" {
+		fields["response_body"] = e.ResponseBody
+	}
+
+	return fields
+}
+
+// String formats e as a single line
+func (e RequestLog) String() string {
+	s := fmt.Sprintf("%s %s status=%d duration=%s request_id=%s", e.Method, e.URL, e.Status, e.Duration, e.RequestID)
+
+	if e.Error != "" {
+		s += fmt.Sprintf(" error=%q", e.Error)
+	}
+	if e.RequestBody != "" {
+		s += fmt.Sprintf(" request_body=%q", e.RequestBody)
+	}
+	if e.ResponseBody != "" {
+		s += fmt.Sprintf(" response_body=%q", e.ResponseBody)
+	}
+
+	return s
+}
+
+// Redacted replaces sensitive values in log entries
+const Redacted = "[REDACTED]"
+
+// Redactor removes secrets from the requests and responses a Client logs
+type Redactor struct {
+	// Headers lists headers whose values are replaced.
+	Headers []string
+	// Fields lists JSON keys, at any depth, and form and query parameters whose values are replaced.
+	Fields []string
+	// Paths lists URL path fragments of requests whose response bodies are never logged,
+	// such as the token endpoint which answers with a private token.
+	Paths []string
+	// PatchPaths lists the JSON Pointers whose values are replaced in JSON Patch bodies, which are
+	// redacted by path rather than by Fields. A "*" segment matches any one segment, and a pointer
+	// also covers everything below it.
+	PatchPaths []string
+}
+
+// DefaultRedactor hides credentials, passwords, secret values, private keys and deployment tokens
+func DefaultRedactor() *Redactor {
+	return &Redactor{
+		Headers: []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"},
+		Fields: []string{
+			"password", "value", "private_key", "deployment_token",
+			"private_token", "kumoru_token_private", "secret",
+		},
+		Paths:      []string{"/v1/tokens/"},
+		PatchPaths: []string{"/certificates/private_key", "/environment/*", "/deployment_token"},
+	}
+}
+
+// Header returns a copy of h with the values of sensitive headers replaced
+func (r *Redactor) Header(h http.Header) http.Header {
+	redacted := http.Header{}
+	for name, values := range h {
+		if r.sensitiveHeader(name) {
+			values = []string{Redacted}
+		}
+		redacted[name] = values
+	}
+	return redacted
+}
+
+// URL returns u with the values of sensitive query parameters replaced
+func (r *Redactor) URL(u *url.URL) string {
+	if u.RawQuery == "" {
+		return u.String()
+	}
+
+	c := *u
+	c.RawQuery = r.values(u.Query()).Encode()
+	return c.String()
+}
+
+// Body returns body with the values of sensitive fields replaced.
+// Bodies which are neither JSON nor a form are returned unchanged.
+func (r *Redactor) Body(contentType string, body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+
+	if mediaType == "application/json-patch+json" {
+		var ops []map[string]interface{}
+		if err := json.Unmarshal(body, &ops); err == nil {
+			for _, op := range ops {
+				if value, ok := op["value"]; ok {
+					path, _ := op["path"].(string)
+					op["value"] = r.patchValue(path, value)
+				}
+			}
+			b, _ := json.Marshal(ops)
+			return string(b)
+		}
+	}
+
+	if strings.HasSuffix(mediaType, "json") || (mediaType == "" && json.Valid(body)) {
+		var v interface{}
+		d := json.NewDecoder(bytes.NewReader(body))
+		d.UseNumber()
+		if err := d.Decode(&v); err == nil {
+			b, _ := json.Marshal(r.json(v))
+			return string(b)
+		}
+	}
+
+	if mediaType == "application/x-www-form-urlencoded" {
+		if values, err := url.ParseQuery(string(body)); err == nil {
+			return r.values(values).Encode()
+		}
+	}
+
+	return string(body)
+}
+
+// HidesBody reports whether the response body of a request to u must not be logged or recorded
+func (r *Redactor) HidesBody(u *url.URL) bool {
+	for _, p := range r.Paths {
+		if strings.Contains(u.Path, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Redactor) json(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if r.sensitiveField(key) {
+				v[key] = Redacted
+			} else {
+				v[key] = r.json(value)
+			}
+		}
+	case []interface{}:
+		for i, value := range v {
+			v[i] = r.json(value)
+		}
+	}
+	return v
+}
+
+// patchValue redacts the value a JSON Patch operation sets at path, descending into objects
+// and arrays so that a value replacing a parent of a sensitive path is redacted too
+func (r *Redactor) patchValue(path string, v interface{}) interface{} {
+	if r.sensitivePatchPath(path) {
+		return Redacted
+	}
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			v[key] = r.patchValue(path+"/"+patchPointerEscaper.Replace(key), value)
+		}
+	case []interface{}:
+		for i, value := range v {
+			v[i] = r.patchValue(fmt.Sprintf("%s/%d", path, i), value)
+		}
+	}
+	return v
+}
+
+var patchPointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+func (r *Redactor) sensitivePatchPath(path string) bool {
+	segments := strings.Split(path, "/")
+
+	for _, p := range r.PatchPaths {
+		pattern := strings.Split(p, "/")
+		if len(segments) < len(pattern) {
+			continue
+		}
+
+		match := true
+		for i, s := range pattern {
+			if s != "*" && s != segments[i] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Redactor) values(values url.Values) url.Values {
+	redacted := url.Values{}
+	for name, vs := range values {
+		if r.sensitiveField(name) {
+			vs = []string{Redacted}
+		}
+		redacted[name] = vs
+	}
+	return redacted
+}
+
+func (r *Redactor) sensitiveHeader(name string) bool {
+	for _, h := range r.Headers {
+		if strings.EqualFold(h, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Redactor) sensitiveField(name string) bool {
+	for _, f := range r.Fields {
+		if strings.EqualFold(f, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactor returns k's Redactor, defaulting to DefaultRedactor
+func (k *Client) redactor() *Redactor {
+	if k.Redactor != nil {
+		return k.Redactor
+	}
+	return DefaultRedactor()
+}
+
+// logRequest writes entry to k.Logger
+func (k *Client) logRequest(entry RequestLog) {
+	switch l := k.Logger.(type) {
+	case nil:
+	case RequestLogger:
+		l.LogRequest(entry)
+	case *log.Logger:
+		l.WithFields(log.Fields(entry.Fields())).Info("kumoru request")
+	default:
+		l.Infof("kumoru request: %s", entry)
+	}
+}
+
+// newRequestLog describes the attempt req and its outcome for logging. Unless the response is
+// being streamed its body is read and replaced, so that it can be logged.
+func (k *Client) newRequestLog(req *http.Request, resp *http.Response, err error, duration time.Duration) RequestLog {
+	r := k.redactor()
+
+	entry := RequestLog{
+		Method:        req.Method,
+		URL:           r.URL(req.URL),
+		Duration:      duration,
+		RequestHeader: r.Header(req.Header),
+	}
+
+	if k.body == nil && hasBody(req.Method) {
+		entry.RequestBody = r.Body(req.Header.Get("Content-Type"), []byte(k.RawString))
+	}
+
+	if err != nil {
+		entry.Error = err.Error()
+		return entry
+	}
+
+	entry.Status = resp.StatusCode
+	entry.RequestID = requestID(resp)
+	entry.ResponseHeader = r.Header(resp.Header)
+
+	if !k.streaming && !r.HidesBody(req.URL) {
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		entry.ResponseBody = r.Body(resp.Header.Get("Content-Type"), body)
+	}
+
+	return entry
+}
+
+// WithRedactor sets the Redactor applied to logged requests and responses
+func WithRedactor(r *Redactor) Option {
+	return func(k *Client) error {
+		k.Redactor = r
+		return nil
+	}
+}
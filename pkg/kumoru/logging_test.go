@@ -0,0 +1,130 @@
+/*
+Copyright 2016 Kumoru.io
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kumoru
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+type captureLogger struct {
+	Logger
+	entries []RequestLog
+}
+
+func (c *captureLogger) LogRequest(entry RequestLog) {
+	c.entries = append(c.entries, entry)
+}
+
+func TestRedactor(t *testing.T) {
+	r := DefaultRedactor()
+
+	h := r.Header(http.Header{"Authorization": {"KUMORU PUBLIC:SIGNATURE"}, "Accept": {"*/*"}})
+	assert.Equal(t, Redacted, h.Get("Authorization"))
+	assert.Equal(t, "*/*", h.Get("Accept"))
+
+	form := r.Body("application/x-www-form-urlencoded", []byte("email=a%40b.c&password=hunter2"))
+	assert.Contains(t, form, "email=a%40b.c")
+	assert.NotContains(t, form, "hunter2")
+
+	body := r.Body("application/json", []byte(`{"name":"db","certificates":{"private_key":"KEY"},"secrets":[{"value":"s3cr3t"}]}`))
+	assert.NotContains(t, body, "KEY")
+	assert.NotContains(t, body, "s3cr3t")
+	assert.Contains(t, body, `"name":"db"`)
+
+	u, _ := url.Parse("https://application.example/v1/applications/?deployment_token=TOKEN&tag=v1")
+	assert.NotContains(t, r.URL(u), "TOKEN")
+	assert.Contains(t, r.URL(u), "tag=v1")
+
+	assert.Equal(t, "plain text", r.Body("text/plain", []byte("plain text")))
+}
+
+func TestRequestLog(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Request-Id", "req-1")
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasPrefix(r.URL.Path, "/v1/tokens/") {
+			w.Write([]byte(`{"token":"PRIVATE"}`))
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"uuid":"1234","value":"s3cr3t"}`))
+	}))
+	defer ts.Close()
+
+	logger := &captureLogger{Logger: log.New()}
+	k := testSignedClient(ts.URL + "/v1/secrets/")
+	k.Method = POST
+	k.Debug = true
+	k.SetLogger(logger)
+	k.Send("value=s3cr3t&labels=db")
+
+	_, body, errs := k.End()
+	assert.Nil(t, errs)
+	assert.Contains(t, body, "s3cr3t", "the caller still receives the response body")
+
+	if assert.Len(t, logger.entries, 1) {
+		e := logger.entries[0]
+		assert.Equal(t, POST, e.Method)
+		assert.Equal(t, http.StatusCreated, e.Status)
+		assert.Equal(t, "req-1", e.RequestID)
+		assert.Equal(t, Redacted, e.RequestHeader.Get("Authorization"))
+		assert.Contains(t, e.RequestBody, "labels=db")
+		assert.Contains(t, e.ResponseBody, "1234")
+		assert.NotContains(t, e.String(), "s3cr3t")
+	}
+
+	logger.entries = nil
+	k = testSignedClient(ts.URL + "/v1/tokens/")
+	k.Method = GET
+	k.Debug = true
+	k.SetLogger(logger)
+	_, body, _ = k.End()
+	assert.Contains(t, body, "PRIVATE")
+	if assert.Len(t, logger.entries, 1) {
+		assert.Empty(t, logger.entries[0].ResponseBody)
+	}
+}
+
+func TestRequestLogLogrus(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Request-Id", "req-2")
+	}))
+	defer ts.Close()
+
+	var out bytes.Buffer
+	logger := log.New()
+	logger.Out = &out
+	logger.Formatter = &log.JSONFormatter{}
+
+	k := testSignedClient(ts.URL + "/v1/applications/")
+	k.Method = GET
+	k.Debug = true
+	k.SetLogger(logger)
+	k.End()
+
+	assert.Contains(t, out.String(), `"request_id":"req-2"`)
+	assert.Contains(t, out.String(), `"status":200`)
+	assert.NotContains(t, out.String(), "PUBLIC_TOKEN:")
+}
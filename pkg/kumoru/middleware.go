@@ -0,0 +1,255 @@
+/*
+Copyright 2016 Kumoru.io
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kumoru
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// RoundTripFunc sends one attempt of a request and returns its response
+type RoundTripFunc func(*http.Request) (*http.Response, error)
+
+// Middleware wraps the rest of the chain. It may change the request, the response,
+// or not call next at all.
+type Middleware func(next RoundTripFunc) RoundTripFunc
+
+// BeforeHook is called with each attempt before it is signed. An error aborts the request without retrying.
+type BeforeHook func(req *http.Request) error
+
+// AfterHook is called with the outcome of each attempt
+type AfterHook func(req *http.Request, resp *http.Response, err error)
+
+// Names of the built-in stages of the chain, in their default order.
+// Each attempt passes through the chain from first to last stage and then to the transport.
+const (
+	StageHooks     = "hooks"
+	StageRateLimit = "ratelimit"
+	StageSign      = "sign"
+	StageLog       = "log"
+)
+
+// stage is a named step of the chain. Built-in stages have no middleware of their own.
+type stage struct {
+	name       string
+	middleware Middleware
+}
+
+func defaultStages() []stage {
+	return []stage{{name: StageHooks}, {name: StageRateLimit}, {name: StageSign}, {name: StageLog}}
+}
+
+// abortError marks an error which must not be retried
+type abortError struct {
+	err error
+}
+
+func (e abortError) Error() string {
+	return e.err.Error()
+}
+
+// Stages returns the names of the stages of k's chain in order
+func (k *Client) Stages() []string {
+	var names []string
+	for _, s := range k.stageList() {
+		names = append(names, s.name)
+	}
+	return names
+}
+
+// Use adds m at the end of the chain, next to the transport, where it sees the signed request
+func (k *Client) Use(name string, m Middleware) *Client {
+	k.stages = append(k.stageList(), stage{name: name, middleware: m})
+	return k
+}
+
+// UseBefore inserts m before the stage named before, e.g. before StageSign to change the request being signed
+func (k *Client) UseBefore(before, name string, m Middleware) error {
+	return k.insertStage(before, 0, stage{name: name, middleware: m})
+}
+
+// UseAfter inserts m after the stage named after
+func (k *Client) UseAfter(after, name string, m Middleware) error {
+	return k.insertStage(after, 1, stage{name: name, middleware: m})
+}
+
+// RemoveStage removes the stage named name from the chain. Built-in stages may be removed too.
+func (k *Client) RemoveStage(name string) {
+	stages := []stage{}
+	for _, s := range k.stageList() {
+		if s.name != name {
+			stages = append(stages, s)
+		}
+	}
+	k.stages = stages
+}
+
+func (k *Client) insertStage(at string, offset int, s stage) error {
+	stages := k.stageList()
+
+	for i := range stages {
+		if stages[i].name == at {
+			i += offset
+			k.stages = append(stages[:i:i], append([]stage{s}, stages[i:]...)...)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("kumoru: no stage named %s", at)
+}
+
+// stageList returns a copy of k's stages, which may be changed freely
+func (k *Client) stageList() []stage {
+	if k.stages == nil {
+		return defaultStages()
+	}
+	return append([]stage(nil), k.stages...)
+}
+
+// AddBeforeHook adds a hook called with each attempt before it is signed
+func (k *Client) AddBeforeHook(h BeforeHook) *Client {
+	k.beforeHooks = append(k.beforeHooks, h)
+	return k
+}
+
+// AddAfterHook adds a hook called with the outcome of each attempt
+func (k *Client) AddAfterHook(h AfterHook) *Client {
+	k.afterHooks = append(k.afterHooks, h)
+	return k
+}
+
+// chain builds the round trip of an attempt from k's stages, ending with client
+func (k *Client) chain(client *http.Client) (RoundTripFunc, error) {
+	roundTrip := RoundTripFunc(client.Do)
+	if k.DryRun {
+		roundTrip = k.dryRun(roundTrip)
+	}
+	stages := k.stageList()
+
+	for i := len(stages) - 1; i >= 0; i-- {
+		m := stages[i].middleware
+		if m == nil {
+			var ok bool
+			if m, ok = k.builtinStage(stages[i].name); !ok {
+				return nil, fmt.Errorf("kumoru: stage %s has no middleware", stages[i].name)
+			}
+		}
+		roundTrip = m(roundTrip)
+	}
+
+	return roundTrip, nil
+}
+
+func (k *Client) builtinStage(name string) (Middleware, bool) {
+	switch name {
+	case StageHooks:
+		return k.hooksStage, true
+	case StageRateLimit:
+		return k.rateLimitStage, true
+	case StageSign:
+		return k.signStage, true
+	case StageLog:
+		return k.logStage, true
+	}
+	return nil, false
+}
+
+func (k *Client) hooksStage(next RoundTripFunc) RoundTripFunc {
+	return func(req *http.Request) (*http.Response, error) {
+		for _, h := range k.beforeHooks {
+			if err := h(req); err != nil {
+				return nil, abortError{err}
+			}
+		}
+
+		resp, err := next(req)
+
+		for _, h := range k.afterHooks {
+			h(req, resp, err)
+		}
+
+		return resp, err
+	}
+}
+
+func (k *Client) rateLimitStage(next RoundTripFunc) RoundTripFunc {
+	return func(req *http.Request) (*http.Response, error) {
+		limiter := k.limiter(req)
+
+		release, err := limiter.Wait(req.Context())
+		if err != nil {
+			return nil, abortError{err}
+		}
+
+		resp, err := next(req)
+		if err != nil {
+			release()
+			return resp, err
+		}
+
+		limiter.Observe(resp)
+		resp.Body = &releaseBody{ReadCloser: resp.Body, release: release}
+		return resp, nil
+	}
+}
+
+func (k *Client) signStage(next RoundTripFunc) RoundTripFunc {
+	return func(req *http.Request) (*http.Response, error) {
+		if err := k.authenticate(req); err != nil {
+			return nil, abortError{err}
+		}
+		return next(req)
+	}
+}
+
+func (k *Client) logStage(next RoundTripFunc) RoundTripFunc {
+	return func(req *http.Request) (*http.Response, error) {
+		if !k.Debug {
+			return next(req)
+		}
+
+		start := time.Now()
+		resp, err := next(req)
+		k.logRequest(k.newRequestLog(req, resp, err, time.Since(start)))
+		return resp, err
+	}
+}
+
+// WithMiddleware adds m at the end of the chain, as Use does
+func WithMiddleware(name string, m Middleware) Option {
+	return func(k *Client) error {
+		k.Use(name, m)
+		return nil
+	}
+}
+
+// WithBeforeHook adds a hook called with each attempt before it is signed
+func WithBeforeHook(h BeforeHook) Option {
+	return func(k *Client) error {
+		k.AddBeforeHook(h)
+		return nil
+	}
+}
+
+// WithAfterHook adds a hook called with the outcome of each attempt
+func WithAfterHook(h AfterHook) Option {
+	return func(k *Client) error {
+		k.AddAfterHook(h)
+		return nil
+	}
+}
@@ -0,0 +1,138 @@
+/*
+Copyright 2016 Kumoru.io
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kumoru
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddlewareOrder(t *testing.T) {
+	var received http.Header
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header
+	}))
+	defer ts.Close()
+
+	k := testSignedClient(ts.URL + "/v1/applications/")
+	k.Method = GET
+
+	assert.Equal(t, []string{StageHooks, StageRateLimit, StageSign, StageLog}, k.Stages())
+
+	var signedSeen bool
+	k.Use("audit", func(next RoundTripFunc) RoundTripFunc {
+		return func(req *http.Request) (*http.Response, error) {
+			signedSeen = req.Header.Get("Authorization") != ""
+			return next(req)
+		}
+	})
+	assert.Nil(t, k.UseBefore(StageSign, "correlation", func(next RoundTripFunc) RoundTripFunc {
+		return func(req *http.Request) (*http.Response, error) {
+			assert.Empty(t, req.Header.Get("Authorization"), "stages before signing see the unsigned request")
+			req.Header.Set("X-Correlation-ID", "abc123")
+			return next(req)
+		}
+	}))
+	assert.NotNil(t, k.UseAfter("missing", "metrics", nil))
+
+	assert.Equal(t, []string{StageHooks, StageRateLimit, "correlation", StageSign, StageLog, "audit"}, k.Stages())
+	assert.Equal(t, k.Stages(), k.Clone().Stages())
+
+	_, _, errs := k.End()
+	assert.Nil(t, errs)
+	assert.True(t, signedSeen)
+	assert.Equal(t, "abc123", received.Get("X-Correlation-ID"))
+
+	k.RemoveStage(StageSign)
+	k.End()
+	assert.Empty(t, received.Get("Authorization"))
+}
+
+func TestHooks(t *testing.T) {
+	var hits int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer ts.Close()
+
+	var statuses []int
+	k, _ := NewClient(
+		WithoutCredentials(),
+		WithRetryPolicy(DefaultRetryPolicy()),
+		WithAfterHook(func(req *http.Request, resp *http.Response, err error) {
+			statuses = append(statuses, resp.StatusCode)
+		}),
+	)
+
+	k.Get(ts.URL)
+	k.End()
+	assert.Equal(t, []int{http.StatusAccepted}, statuses)
+
+	k.AddBeforeHook(func(req *http.Request) error {
+		return errors.New("audit log unavailable")
+	})
+	k.Get(ts.URL)
+	_, _, errs := k.End()
+	if assert.Len(t, errs, 1) {
+		assert.EqualError(t, errs[0], "audit log unavailable")
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&hits), "a failing hook aborts without retrying")
+}
+
+func TestMiddlewareFaultInjection(t *testing.T) {
+	var hits int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+	}))
+	defer ts.Close()
+
+	var injected int32
+	fault := func(next RoundTripFunc) RoundTripFunc {
+		return func(req *http.Request) (*http.Response, error) {
+			if atomic.AddInt32(&injected, 1) == 1 {
+				return &http.Response{
+					StatusCode: http.StatusServiceUnavailable,
+					Header:     http.Header{},
+					Body:       ioutil.NopCloser(strings.NewReader("injected")),
+					Request:    req,
+				}, nil
+			}
+			return next(req)
+		}
+	}
+
+	policy := DefaultRetryPolicy()
+	policy.MinBackoff = time.Millisecond
+
+	k, _ := NewClient(WithoutCredentials(), WithRetryPolicy(policy), WithMiddleware("fault", fault))
+	k.Get(ts.URL)
+	resp, _, errs := k.End()
+
+	assert.Nil(t, errs)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&injected), "each attempt passes through the chain")
+	assert.Equal(t, int32(1), atomic.LoadInt32(&hits))
+}
@@ -0,0 +1,241 @@
+/*
+Copyright 2016 Kumoru.io
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kumoru
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Errors returned by NewClient when the configuration is incomplete
+var (
+	ErrMissingEndpoint = errors.New("kumoru: an api endpoint is not configured")
+	ErrMissingTokens   = errors.New("kumoru: public and private tokens are required")
+	ErrMissingRole     = errors.New("kumoru: a role UUID is required")
+)
+
+// Option configures a Client built by NewClient
+type Option func(*Client) error
+
+// NewClient creates a Client from opts alone. Unlike New it does not read
+// $HOME/.kumoru/config or the environment unless asked to with WithConfigFile,
+// and it never logs: an incomplete configuration is reported as an error.
+//
+// Usage Example:
+//
+// k, err := kumoru.NewClient(
+// kumoru.WithCredentials(public, private),
+// kumoru.WithRole(roleUUID),
+// kumoru.WithTimeout(30*time.Second),
+// )
+func NewClient(opts ...Option) (*Client, error) {
+	k := &Client{
+		Client: &http.Client{},
+		Data:   make(map[string]interface{}),
+		EndPoint: &Endpoints{
+			Application:   DefaultApplicationURL,
+			Authorization: DefaultAuthorizationURL,
+			Location:      DefaultLocationURL,
+		},
+		FormData:   url.Values{},
+		Header:     make(map[string]string),
+		Logger:     log.New(),
+		QueryData:  url.Values{},
+		SliceData:  []interface{}{},
+		TargetType: "form",
+		Tokens:     &Ktokens{},
+		Transport:  DefaultTransport(),
+	}
+
+	for _, opt := range opts {
+		if err := opt(k); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := k.validate(); err != nil {
+		return nil, err
+	}
+
+	return k, nil
+}
+
+// validate reports the first piece of missing configuration
+func (k *Client) validate() error {
+	if k.EndPoint.Application == "" || k.EndPoint.Authorization == "" || k.EndPoint.Location == "" {
+		return ErrMissingEndpoint
+	}
+
+	if k.anonymous {
+		return nil
+	}
+
+	if k.Signer != nil {
+		if k.Signer.PublicToken() == "" {
+			return ErrMissingTokens
+		}
+	} else if k.Tokens.Public == "" || k.Tokens.Private == "" {
+		return ErrMissingTokens
+	}
+
+	if k.RoleUUID == "" {
+		return ErrMissingRole
+	}
+
+	return nil
+}
+
+// WithConfigFile loads endpoints, tokens and the active role from an ini file
+// in the format of $HOME/.kumoru/config, using the profile selected by KUMORU_PROFILE.
+// Options given after it take precedence.
+func WithConfigFile(filename string) Option {
+	return WithProfile(filename, ActiveProfile())
+}
+
+// WithProfile is like WithConfigFile but loads the named profile.
+func WithProfile(filename, profile string) Option {
+	return func(k *Client) error {
+		if !HasProfile(filename, profile) {
+			return fmt.Errorf("kumoru: profile %s not found in %s", profile, filename)
+		}
+
+		t, err := LoadTokens(filename, ProfileSection(profile, "tokens"))
+		if err != nil {
+			return fmt.Errorf("kumoru: loading tokens from %s: %s", filename, err)
+		}
+
+		roleUUID, err := LoadRole(filename, ProfileSection(profile, "auth"))
+		if err != nil {
+			return fmt.Errorf("kumoru: loading role from %s: %s", filename, err)
+		}
+
+		if c := LoadClientCertificate(filename, profile); !c.IsZero() {
+			if err := k.SetClientCertificate(c); err != nil {
+				return err
+			}
+		}
+
+		e := LoadProfileEndpoints(filename, profile)
+
+		k.EndPoint = &e
+		k.Tokens = &t
+		k.RoleUUID = roleUUID
+		k.RateLimits = LoadRateLimits(filename, profile)
+		return nil
+	}
+}
+
+// WithEndpoints sets the api endpoints. Empty fields keep their current value.
+func WithEndpoints(e Endpoints) Option {
+	return func(k *Client) error {
+		if e.Application != "" {
+			k.EndPoint.Application = e.Application
+		}
+		if e.Authorization != "" {
+			k.EndPoint.Authorization = e.Authorization
+		}
+		if e.Location != "" {
+			k.EndPoint.Location = e.Location
+		}
+		return nil
+	}
+}
+
+// WithCredentials sets the public and private tokens used to sign requests
+func WithCredentials(public, private string) Option {
+	return func(k *Client) error {
+		k.Tokens = &Ktokens{Public: public, Private: private}
+		return nil
+	}
+}
+
+// WithRole sets the role UUID sent as the request context
+func WithRole(roleUUID string) Option {
+	return func(k *Client) error {
+		k.RoleUUID = roleUUID
+		return nil
+	}
+}
+
+// WithoutCredentials allows a Client with no tokens or role, for the unsigned
+// calls used to create accounts and obtain tokens.
+func WithoutCredentials() Option {
+	return func(k *Client) error {
+		k.anonymous = true
+		return nil
+	}
+}
+
+// WithHTTPClient sets the http.Client used to send requests
+func WithHTTPClient(c *http.Client) Option {
+	return func(k *Client) error {
+		if c == nil {
+			return errors.New("kumoru: http client must not be nil")
+		}
+		k.Client = c
+		return nil
+	}
+}
+
+// WithLogger sets the logger used for debug output
+func WithLogger(logger Logger) Option {
+	return func(k *Client) error {
+		if logger == nil {
+			return errors.New("kumoru: logger must not be nil")
+		}
+		k.Logger = logger
+		return nil
+	}
+}
+
+// WithUserAgent sets the User-Agent header sent with every request
+func WithUserAgent(userAgent string) Option {
+	return func(k *Client) error {
+		k.UserAgent = userAgent
+		return nil
+	}
+}
+
+// WithTimeout limits the time taken by each request, including reading the response body
+func WithTimeout(d time.Duration) Option {
+	return func(k *Client) error {
+		if d < 0 {
+			return fmt.Errorf("kumoru: invalid timeout %s", d)
+		}
+		// Copy the client, which may have been given by WithHTTPClient and be shared by the caller.
+		c := http.Client{}
+		if k.Client != nil {
+			c = *k.Client
+		}
+		c.Timeout = d
+		k.Client = &c
+		return nil
+	}
+}
+
+// WithDebug enables logging of each request and response
+func WithDebug(enable bool) Option {
+	return func(k *Client) error {
+		k.Debug = enable
+		return nil
+	}
+}
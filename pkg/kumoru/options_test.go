@@ -0,0 +1,94 @@
+/*
+Copyright 2016 Kumoru.io
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kumoru
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewClient(t *testing.T) {
+	k, err := NewClient(
+		WithCredentials("PUBLIC_TOKEN", "PRIVATE_TOKEN"),
+		WithRole("ROLE_UUID"),
+		WithEndpoints(Endpoints{Location: "https://location.example.com"}),
+		WithTimeout(5*time.Second),
+	)
+
+	assert.Nil(t, err, "Expect no error")
+
+	assert.Equal(t, "PUBLIC_TOKEN", k.Tokens.Public, "Expect Public Token to match")
+	assert.Equal(t, "PRIVATE_TOKEN", k.Tokens.Private, "Expect Private Token to match")
+	assert.Equal(t, "ROLE_UUID", k.RoleUUID, "Expect role to match")
+	assert.Equal(t, "https://location.example.com", k.EndPoint.Location, "Expect location endpoint to match")
+	assert.Equal(t, DefaultApplicationURL, k.EndPoint.Application, "Expect application endpoint to default")
+	assert.Equal(t, 5*time.Second, k.Client.Timeout, "Expect timeout to match")
+}
+
+func TestNewClientTimeoutCopiesClient(t *testing.T) {
+	shared := &http.Client{Timeout: time.Minute}
+
+	k, err := NewClient(WithoutCredentials(), WithHTTPClient(shared), WithTimeout(5*time.Second))
+
+	assert.Nil(t, err, "Expect no error")
+	assert.Equal(t, 5*time.Second, k.Client.Timeout, "Expect timeout to match")
+	assert.Equal(t, time.Minute, shared.Timeout, "Expect the caller's client to keep its timeout")
+}
+
+func TestNewClientIncomplete(t *testing.T) {
+	_, err := NewClient()
+	assert.Equal(t, ErrMissingTokens, err, "Expect missing tokens")
+
+	_, err = NewClient(WithCredentials("PUBLIC_TOKEN", "PRIVATE_TOKEN"))
+	assert.Equal(t, ErrMissingRole, err, "Expect missing role")
+
+	_, err = NewClient(WithoutCredentials())
+	assert.Nil(t, err, "Expect no error without credentials")
+}
+
+func TestNewClientConfigFile(t *testing.T) {
+	k, err := NewClient(WithConfigFile("example-cfg.ini"))
+
+	assert.Nil(t, err, "Expect no error")
+
+	assert.Equal(t, "PUBLIC_TOKEN", k.Tokens.Public, "Expect Public Token to match")
+	assert.Equal(t, "ROLE_UUID", k.RoleUUID, "Expect role to match")
+
+	_, err = NewClient(WithConfigFile("fake-file.ini"))
+	assert.NotNil(t, err, "Expecting an error")
+}
+
+func TestNewClientUserAgent(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("User-Agent") != "kumoru-test/1.0" {
+			t.Errorf("Expected 'User-Agent' == %q; got %q", "kumoru-test/1.0", r.Header.Get("User-Agent"))
+		}
+	}))
+	defer ts.Close()
+
+	k, err := NewClient(WithoutCredentials(), WithUserAgent("kumoru-test/1.0"))
+	assert.Nil(t, err, "Expect no error")
+
+	k.Get(ts.URL + "/v1/applications/")
+	_, _, errs := k.End()
+
+	assert.Nil(t, errs, "Expect no errors")
+}
@@ -0,0 +1,192 @@
+/*
+Copyright 2016 Kumoru.io
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kumoru
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Pagination headers and parameters. A list endpoint given a limit answers with at most that many items and,
+// when there are more, a Link header with rel="next" or a cursor header whose value is passed back as cursor.
+const (
+	LimitParameter   = "limit"
+	CursorParameter  = "cursor"
+	NextCursorHeader = "X-Kumoru-Next-Cursor"
+)
+
+// PageOptions controls how a list is fetched
+type PageOptions struct {
+	// PageSize is the number of items asked for in each request. Zero lets the server decide,
+	// which for endpoints without pagination is every item.
+	PageSize int
+	// Limit stops iteration after this many items. Zero means no limit.
+	Limit int
+}
+
+// Pager iterates over the items of a list endpoint, fetching pages as they are needed.
+// Services wrap a Pager in an iterator of their own type.
+type Pager struct {
+	client *Client
+	opts   PageOptions
+	next   string
+	seen   map[SchemaWarning]bool
+
+	resp  *http.Response
+	items []json.RawMessage
+	item  json.RawMessage
+	count int
+	err   error
+}
+
+// NewPager returns a Pager for the list at url, signing each request with client's credentials
+func NewPager(client *Client, url string, opts PageOptions) *Pager {
+	p := &Pager{client: client.Clone(), opts: opts, next: url, seen: make(map[SchemaWarning]bool)}
+
+	// Every item is checked against the same type, so report each difference once.
+	report := client.Clone().schemaWarning
+	p.client.OnSchemaWarning = func(w SchemaWarning) {
+		key := w
+		key.URL = ""
+		if !p.seen[key] {
+			p.seen[key] = true
+			report(w)
+		}
+	}
+
+	return p
+}
+
+// Next advances to the next item, fetching the next page when the current one is used up.
+// It returns false when the list or the limit is exhausted, or on error.
+func (p *Pager) Next(ctx context.Context) bool {
+	if p.err != nil || (p.opts.Limit > 0 && p.count >= p.opts.Limit) {
+		return false
+	}
+
+	for len(p.items) == 0 {
+		if p.next == "" {
+			return false
+		}
+		if p.err = p.fetch(ctx); p.err != nil {
+			return false
+		}
+	}
+
+	p.item, p.items = p.items[0], p.items[1:]
+	p.count++
+
+	return true
+}
+
+// Decode decodes the current item into out, as DecodeJSON does
+func (p *Pager) Decode(out interface{}) error {
+	return p.client.DecodeJSON(p.resp, p.item, out)
+}
+
+// Err returns the error which stopped iteration, if any
+func (p *Pager) Err() error {
+	return p.err
+}
+
+// Response returns the response of the last page fetched
+func (p *Pager) Response() *http.Response {
+	return p.resp
+}
+
+// fetch requests the page at p.next and finds the URL of the page after it
+func (p *Pager) fetch(ctx context.Context) error {
+	k := p.client.Clone()
+	k.Get(p.next)
+	k.SignRequest(true)
+
+	u, err := url.Parse(p.next)
+	if err != nil {
+		return err
+	}
+
+	if size := p.pageSize(); size > 0 && u.Query().Get(LimitParameter) == "" {
+		k.QueryData.Set(LimitParameter, strconv.Itoa(size))
+	}
+
+	var items []json.RawMessage
+	resp, err := k.EndJSON(ctx, &items)
+	if err != nil {
+		return err
+	}
+
+	p.resp = resp
+	p.items = items
+	p.next = ""
+
+	if len(items) == 0 {
+		return nil
+	}
+
+	if next := nextLink(resp.Header["Link"]); next != "" {
+		if ref, err := url.Parse(next); err == nil {
+			p.next = resp.Request.URL.ResolveReference(ref).String()
+		}
+	} else if cursor := resp.Header.Get(NextCursorHeader); cursor != "" {
+		q := resp.Request.URL.Query()
+		q.Set(CursorParameter, cursor)
+		next := *resp.Request.URL
+		next.RawQuery = q.Encode()
+		p.next = next.String()
+	}
+
+	return nil
+}
+
+// pageSize returns the size of page to ask for, no larger than the items still wanted
+func (p *Pager) pageSize() int {
+	size := p.opts.PageSize
+	if remaining := p.opts.Limit - p.count; p.opts.Limit > 0 && (size == 0 || remaining < size) {
+		size = remaining
+	}
+	return size
+}
+
+// nextLink returns the target of the rel="next" link in Link header values
+func nextLink(values []string) string {
+	for _, v := range values {
+		for _, link := range strings.Split(v, ",") {
+			parts := strings.Split(link, ";")
+			target := strings.TrimSpace(parts[0])
+			if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+				continue
+			}
+
+			for _, param := range parts[1:] {
+				param = strings.TrimSpace(param)
+				if !strings.HasPrefix(strings.ToLower(param), "rel=") {
+					continue
+				}
+				for _, rel := range strings.Fields(strings.Trim(param[len("rel="):], `"`)) {
+					if strings.EqualFold(rel, "next") {
+						return target[1 : len(target)-1]
+					}
+				}
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,128 @@
+/*
+Copyright 2016 Kumoru.io
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kumoru
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testList serves ten numbered items, paginated by limit and cursor. Pages are linked with
+// a Link header, or with a cursor header when the request asks for it.
+func testList(requests *[]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*requests = append(*requests, r.URL.RequestURI())
+
+		start, _ := strconv.Atoi(r.URL.Query().Get(CursorParameter))
+		end := 10
+		if limit, err := strconv.Atoi(r.URL.Query().Get(LimitParameter)); err == nil && start+limit < 10 {
+			end = start + limit
+			if r.URL.Query().Get("style") == "cursor" {
+				w.Header().Set(NextCursorHeader, strconv.Itoa(end))
+			} else {
+				w.Header().Set("Link", fmt.Sprintf(`<https://other.example/ignored>; rel="prev", </v1/items/?cursor=%d&limit=%d>; rel="next"`, end, limit))
+			}
+		}
+
+		items := "["
+		for i := start; i < end; i++ {
+			if i > start {
+				items += ","
+			}
+			items += fmt.Sprintf(`{"n":%d}`, i)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(items + "]"))
+	}))
+}
+
+func collect(t *testing.T, p *Pager) []int {
+	var ns []int
+	for p.Next(context.Background()) {
+		var item struct {
+			N int `json:"n"`
+		}
+		assert.Nil(t, p.Decode(&item))
+		ns = append(ns, item.N)
+	}
+	assert.Nil(t, p.Err())
+	return ns
+}
+
+func TestPager(t *testing.T) {
+	var requests []string
+	ts := testList(&requests)
+	defer ts.Close()
+
+	k := testSignedClient("")
+
+	assert.Equal(t, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, collect(t, NewPager(k, ts.URL+"/v1/items/", PageOptions{})))
+	assert.Equal(t, []string{"/v1/items/"}, requests)
+
+	requests = nil
+	assert.Len(t, collect(t, NewPager(k, ts.URL+"/v1/items/", PageOptions{PageSize: 4})), 10)
+	assert.Equal(t, []string{"/v1/items/?limit=4", "/v1/items/?cursor=4&limit=4", "/v1/items/?cursor=8&limit=4"}, requests)
+
+	requests = nil
+	assert.Len(t, collect(t, NewPager(k, ts.URL+"/v1/items/?style=cursor", PageOptions{PageSize: 6})), 10)
+	assert.Equal(t, []string{"/v1/items/?limit=6&style=cursor", "/v1/items/?cursor=6&limit=6&style=cursor"}, requests)
+
+	requests = nil
+	assert.Equal(t, []int{0, 1, 2}, collect(t, NewPager(k, ts.URL+"/v1/items/", PageOptions{Limit: 3})))
+	assert.Equal(t, []string{"/v1/items/?limit=3"}, requests, "no more is fetched than the limit needs")
+}
+
+func TestPagerErrors(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get(CursorParameter) != "" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"error":"unavailable"}`))
+			return
+		}
+		w.Header().Set(NextCursorHeader, "2")
+		w.Write([]byte(`[{"n":0,"extra":true},{"n":1,"extra":true}]`))
+	}))
+	defer ts.Close()
+
+	var warnings []SchemaWarning
+	k := testSignedClient("")
+	WithStrictDecoding(func(w SchemaWarning) { warnings = append(warnings, w) })(k)
+
+	p := NewPager(k, ts.URL+"/v1/items/", PageOptions{PageSize: 2})
+	var ns []int
+	for p.Next(context.Background()) {
+		var item struct {
+			N int `json:"n"`
+		}
+		p.Decode(&item)
+		ns = append(ns, item.N)
+	}
+
+	assert.Equal(t, []int{0, 1}, ns)
+	if apiErr, ok := p.Err().(*APIError); assert.True(t, ok) {
+		assert.Equal(t, http.StatusServiceUnavailable, apiErr.StatusCode)
+	}
+	assert.Len(t, warnings, 1, "each difference is reported once per list")
+}
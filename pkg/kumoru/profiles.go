@@ -0,0 +1,112 @@
+/*
+Copyright 2016 Kumoru.io
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kumoru
+
+import (
+	"os"
+
+	"github.com/go-ini/ini"
+)
+
+// DefaultProfile names the [tokens], [auth] and [endpoints] sections used before profiles existed
+const DefaultProfile = "default"
+
+// ActiveProfile returns the profile named by KUMORU_PROFILE, or DefaultProfile
+func ActiveProfile() string {
+	if p := os.Getenv("KUMORU_PROFILE"); p != "" {
+		return p
+	}
+	return DefaultProfile
+}
+
+// ProfileSection returns the ini section which holds the keys of section for profile.
+// The default profile keeps them in section itself; any other profile keeps every key
+// in a single "profile NAME" section, e.g.
+//
+// [profile prod]
+// kumoru_token_public=PUBLIC_TOKEN
+// kumoru_token_private=PRIVATE_TOKEN
+// role_uuid=ROLE_UUID
+// kumoru_application_api=https://application.api.kumoru.io
+func ProfileSection(profile, section string) string {
+	if isDefaultProfile(profile) {
+		return section
+	}
+	return "profile " + profile
+}
+
+func isDefaultProfile(profile string) bool {
+	return profile == "" || profile == DefaultProfile
+}
+
+// HasProfile reports whether filename has a section for profile. The default profile always exists.
+func HasProfile(filename, profile string) bool {
+	if isDefaultProfile(profile) {
+		return true
+	}
+
+	config, err := ini.Load(filename)
+	if err != nil {
+		return false
+	}
+
+	_, err = config.GetSection(ProfileSection(profile, "tokens"))
+	return err == nil
+}
+
+// LoadProfileEndpoints returns the endpoints of profile. Each endpoint a named profile does not set
+// falls back to the [endpoints] section and then to the environment or the hosted defaults.
+func LoadProfileEndpoints(filename, profile string) Endpoints {
+	e := LoadEndpoints(filename, "endpoints")
+
+	if isDefaultProfile(profile) {
+		return e
+	}
+
+	defaults := defaultEndpoints()
+	if e.Application == "" {
+		e.Application = defaults.Application
+	}
+	if e.Authorization == "" {
+		e.Authorization = defaults.Authorization
+	}
+	if e.Location == "" {
+		e.Location = defaults.Location
+	}
+
+	config, err := ini.Load(filename)
+	if err != nil {
+		return e
+	}
+
+	section, err := config.GetSection(ProfileSection(profile, "endpoints"))
+	if err != nil {
+		return e
+	}
+
+	if v := section.Key("kumoru_application_api").String(); v != "" {
+		e.Application = v
+	}
+	if v := section.Key("kumoru_authorization_api").String(); v != "" {
+		e.Authorization = v
+	}
+	if v := section.Key("kumoru_location_api").String(); v != "" {
+		e.Location = v
+	}
+
+	return e
+}
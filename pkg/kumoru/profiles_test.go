@@ -0,0 +1,98 @@
+/*
+Copyright 2016 Kumoru.io
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kumoru
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestActiveProfile(t *testing.T) {
+	os.Unsetenv("KUMORU_PROFILE")
+	assert.Equal(t, DefaultProfile, ActiveProfile())
+
+	os.Setenv("KUMORU_PROFILE", "prod")
+	defer os.Unsetenv("KUMORU_PROFILE")
+	assert.Equal(t, "prod", ActiveProfile())
+}
+
+func TestProfileSection(t *testing.T) {
+	assert.Equal(t, "tokens", ProfileSection(DefaultProfile, "tokens"))
+	assert.Equal(t, "auth", ProfileSection("", "auth"))
+	assert.Equal(t, "profile prod", ProfileSection("prod", "tokens"))
+	assert.Equal(t, "profile prod", ProfileSection("prod", "endpoints"))
+}
+
+func TestLoadProfile(t *testing.T) {
+	os.Clearenv()
+
+	assert.True(t, HasProfile("example-cfg.ini", "staging"))
+	assert.True(t, HasProfile("example-cfg.ini", DefaultProfile))
+	assert.False(t, HasProfile("example-cfg.ini", "prod"))
+
+	tokens, err := LoadTokens("example-cfg.ini", ProfileSection("staging", "tokens"))
+	assert.Nil(t, err)
+	assert.Equal(t, Ktokens{Public: "STAGING_PUBLIC", Private: "STAGING_PRIVATE"}, tokens)
+
+	role, err := LoadRole("example-cfg.ini", ProfileSection("staging", "auth"))
+	assert.Nil(t, err)
+	assert.Equal(t, "STAGING_ROLE", role)
+
+	e := LoadProfileEndpoints("example-cfg.ini", "staging")
+	assert.Equal(t, "https://application.staging.kumoru.io", e.Application)
+	assert.Equal(t, "https://authorization.api.kumoru.io", e.Authorization, "falls back to [endpoints]")
+	assert.Equal(t, "https://location.api.kumoru.io", e.Location, "falls back to [endpoints]")
+
+	assert.Equal(t, LoadEndpoints("example-cfg.ini", "endpoints"), LoadProfileEndpoints("example-cfg.ini", DefaultProfile))
+}
+
+func TestWithProfile(t *testing.T) {
+	k, err := NewClient(WithProfile("example-cfg.ini", "staging"))
+	if assert.Nil(t, err) {
+		assert.Equal(t, "STAGING_PUBLIC", k.Tokens.Public)
+		assert.Equal(t, "STAGING_ROLE", k.RoleUUID)
+		assert.Equal(t, "https://application.staging.kumoru.io", k.EndPoint.Application)
+	}
+
+	_, err = NewClient(WithProfile("example-cfg.ini", "prod"))
+	assert.NotNil(t, err)
+}
+
+func TestSaveProfile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kumoru")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dir += "/"
+
+	assert.Nil(t, SaveTokens(dir, "config", "tokens", Ktokens{Public: "DEFAULT_PUBLIC", Private: "DEFAULT_PRIVATE"}))
+	assert.Nil(t, SaveTokens(dir, "config", ProfileSection("prod", "tokens"), Ktokens{Public: "PROD_PUBLIC", Private: "PROD_PRIVATE"}))
+	assert.Nil(t, SaveRole(dir, "config", ProfileSection("prod", "auth"), "PROD_ROLE"))
+
+	tokens, _ := LoadTokens(dir+"config", "tokens")
+	assert.Equal(t, "DEFAULT_PUBLIC", tokens.Public)
+
+	tokens, _ = LoadTokens(dir+"config", ProfileSection("prod", "tokens"))
+	assert.Equal(t, "PROD_PUBLIC", tokens.Public)
+
+	role, _ := LoadRole(dir+"config", ProfileSection("prod", "auth"))
+	assert.Equal(t, "PROD_ROLE", role)
+}
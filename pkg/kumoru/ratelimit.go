@@ -0,0 +1,312 @@
+/*
+Copyright 2016 Kumoru.io
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kumoru
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-ini/ini"
+)
+
+// RateLimit limits the requests sent to one api endpoint. The zero value sets no limit, but the
+// endpoint is still paused when the server asks for it with 429 or X-RateLimit-* headers.
+type RateLimit struct {
+	// Rate is the sustained number of requests per second.
+	Rate float64
+	// Burst is the number of requests which may be sent at once; it defaults to 1 when Rate is set.
+	Burst int
+	// MaxConcurrent bounds the requests in flight, until their response body is closed.
+	MaxConcurrent int
+}
+
+// RateLimits configures the limit of each api endpoint
+type RateLimits struct {
+	Application   RateLimit
+	Authorization RateLimit
+	Location      RateLimit
+}
+
+// Limiter is a token bucket and concurrency limit for one endpoint.
+// Clients configured with the same endpoint and limit share a Limiter.
+type Limiter struct {
+	limit RateLimit
+	sem   chan struct{}
+
+	mu           sync.Mutex
+	tokens       float64
+	last         time.Time
+	blockedUntil time.Time
+	inflight     int
+	used         time.Time
+}
+
+// limiterIdle is how long a shared Limiter is kept after it was last used. Limiters for
+// arbitrary hosts would otherwise accumulate for the life of the process.
+const limiterIdle = 10 * time.Minute
+
+var (
+	limiters      = map[string]*Limiter{}
+	limitersMu    sync.Mutex
+	limitersSwept time.Time
+)
+
+// NewLimiter returns a Limiter enforcing l
+func NewLimiter(l RateLimit) *Limiter {
+	if l.Rate > 0 && l.Burst < 1 {
+		l.Burst = 1
+	}
+
+	limiter := &Limiter{limit: l, tokens: float64(l.Burst)}
+	if l.MaxConcurrent > 0 {
+		limiter.sem = make(chan struct{}, l.MaxConcurrent)
+	}
+
+	return limiter
+}
+
+// Wait blocks until a request may be sent or ctx is done. The returned function must be called
+// once the request has completed to free its place.
+func (l *Limiter) Wait(ctx context.Context) (func(), error) {
+	release := func() {}
+
+	if l.sem != nil {
+		select {
+		case l.sem <- struct{}{}:
+			release = func() { <-l.sem }
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	for {
+		wait := l.reserve(time.Now())
+		if wait <= 0 {
+			l.mu.Lock()
+			l.inflight++
+			l.mu.Unlock()
+
+			return func() {
+				l.mu.Lock()
+				l.inflight--
+				l.mu.Unlock()
+				release()
+			}, nil
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			release()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// reserve takes a token and returns zero, or returns how long to wait before trying again
+func (l *Limiter) reserve(now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Before(l.blockedUntil) {
+		return l.blockedUntil.Sub(now)
+	}
+
+	if l.limit.Rate <= 0 {
+		return 0
+	}
+
+	if !l.last.IsZero() {
+		l.tokens += now.Sub(l.last).Seconds() * l.limit.Rate
+		if l.tokens > float64(l.limit.Burst) {
+			l.tokens = float64(l.limit.Burst)
+		}
+	}
+	l.last = now
+
+	if l.tokens >= 1 {
+		l.tokens--
+		return 0
+	}
+
+	return time.Duration((1 - l.tokens) / l.limit.Rate * float64(time.Second))
+}
+
+// Observe pauses the endpoint as asked by resp: until Retry-After on a 429, or until
+// X-RateLimit-Reset once X-RateLimit-Remaining reaches zero. The reset is read as a
+// unix time, or as a number of seconds when it is too small to be one.
+func (l *Limiter) Observe(resp *http.Response) {
+	if resp == nil {
+		return
+	}
+
+	now := time.Now()
+	var until time.Time
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		if wait, ok := retryAfter(resp, now); ok {
+			until = now.Add(wait)
+		}
+	}
+
+	if remaining, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining")); err == nil && remaining <= 0 {
+		if reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+			t := time.Unix(reset, 0)
+			if reset < 1e9 {
+				t = now.Add(time.Duration(reset) * time.Second)
+			}
+			if t.After(until) {
+				until = t
+			}
+		}
+	}
+
+	l.mu.Lock()
+	if until.After(l.blockedUntil) {
+		l.blockedUntil = until
+	}
+	l.mu.Unlock()
+}
+
+// idle reports whether l has been unused since before now-limiterIdle and would behave
+// as a new Limiter: nothing in flight, no pause and a full bucket
+func (l *Limiter) idle(now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.inflight > 0 || now.Before(l.blockedUntil) || now.Sub(l.used) < limiterIdle {
+		return false
+	}
+
+	if l.limit.Rate <= 0 || l.last.IsZero() {
+		return true
+	}
+	return l.tokens+now.Sub(l.last).Seconds()*l.limit.Rate >= float64(l.limit.Burst)
+}
+
+// limiterFor returns the Limiter shared by requests to endpoint with limit
+func limiterFor(endpoint string, limit RateLimit) *Limiter {
+	key := fmt.Sprintf("%s %#v", endpoint, limit)
+	now := time.Now()
+
+	limitersMu.Lock()
+	defer limitersMu.Unlock()
+
+	if now.Sub(limitersSwept) >= limiterIdle {
+		sweepLimiters(now)
+	}
+
+	l, ok := limiters[key]
+	if !ok {
+		l = NewLimiter(limit)
+		limiters[key] = l
+	}
+
+	l.mu.Lock()
+	l.used = now
+	l.mu.Unlock()
+
+	return l
+}
+
+// sweepLimiters drops the idle limiters. limitersMu must be held.
+func sweepLimiters(now time.Time) {
+	for key, l := range limiters {
+		if l.idle(now) {
+			delete(limiters, key)
+		}
+	}
+	limitersSwept = now
+}
+
+// limiter returns the Limiter for the endpoint req is sent to. Requests to a URL which is
+// not one of k's endpoints are limited per host, by server signals only.
+func (k *Client) limiter(req *http.Request) *Limiter {
+	target := req.URL.String()
+
+	if k.EndPoint != nil {
+		for _, e := range []struct {
+			url   string
+			limit RateLimit
+		}{
+			{k.EndPoint.Application, k.RateLimits.Application},
+			{k.EndPoint.Authorization, k.RateLimits.Authorization},
+			{k.EndPoint.Location, k.RateLimits.Location},
+		} {
+			if e.url != "" && strings.HasPrefix(target, e.url) {
+				return limiterFor(e.url, e.limit)
+			}
+		}
+	}
+
+	return limiterFor(req.URL.Scheme+"://"+req.URL.Host, RateLimit{})
+}
+
+// releaseBody calls release once the body it wraps is closed
+type releaseBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *releaseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
+
+// LoadRateLimits reads the rate limits of profile in filename. The ratelimits section holds
+// <endpoint>_rate, <endpoint>_burst and <endpoint>_max_concurrent for the application,
+// authorization and location endpoints.
+func LoadRateLimits(filename, profile string) RateLimits {
+	config, err := ini.Load(filename)
+	if err != nil {
+		return RateLimits{}
+	}
+
+	section := config.Section(ProfileSection(profile, "ratelimits"))
+	load := func(endpoint string) RateLimit {
+		return RateLimit{
+			Rate:          section.Key(endpoint + "_rate").MustFloat64(0),
+			Burst:         section.Key(endpoint + "_burst").MustInt(0),
+			MaxConcurrent: section.Key(endpoint + "_max_concurrent").MustInt(0),
+		}
+	}
+
+	return RateLimits{
+		Application:   load("application"),
+		Authorization: load("authorization"),
+		Location:      load("location"),
+	}
+}
+
+// WithRateLimits limits the requests sent to each api endpoint.
+// Limits are shared with every Client using the same endpoint and limit.
+func WithRateLimits(limits RateLimits) Option {
+	return func(k *Client) error {
+		k.RateLimits = limits
+		return nil
+	}
+}
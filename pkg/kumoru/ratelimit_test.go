@@ -0,0 +1,173 @@
+/*
+Copyright 2016 Kumoru.io
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kumoru
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimiterTokenBucket(t *testing.T) {
+	l := NewLimiter(RateLimit{Rate: 20, Burst: 2})
+	start := time.Now()
+
+	for i := 0; i < 4; i++ {
+		release, err := l.Wait(context.Background())
+		assert.Nil(t, err)
+		release()
+	}
+
+	assert.True(t, time.Since(start) >= 80*time.Millisecond, "requests beyond the burst wait for tokens")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	l = NewLimiter(RateLimit{Rate: 0.1})
+	l.Wait(ctx)
+	_, err := l.Wait(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestLimiterObserve(t *testing.T) {
+	l := NewLimiter(RateLimit{})
+	assert.Equal(t, time.Duration(0), l.reserve(time.Now()), "no limit is set")
+
+	l.Observe(&http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{"Retry-After": {"2"}}})
+	assert.True(t, l.reserve(time.Now()) > time.Second, "a 429 pauses the endpoint")
+
+	l = NewLimiter(RateLimit{})
+	l.Observe(&http.Response{StatusCode: http.StatusOK, Header: http.Header{
+		"X-Ratelimit-Remaining": {"0"},
+		"X-Ratelimit-Reset":     {"3"},
+	}})
+	assert.True(t, l.reserve(time.Now()) > 2*time.Second, "an exhausted quota pauses the endpoint until its reset")
+
+	l = NewLimiter(RateLimit{})
+	l.Observe(&http.Response{StatusCode: http.StatusOK, Header: http.Header{
+		"X-Ratelimit-Remaining": {"10"},
+		"X-Ratelimit-Reset":     {"3"},
+	}})
+	assert.Equal(t, time.Duration(0), l.reserve(time.Now()))
+}
+
+func TestRateLimitMaxConcurrent(t *testing.T) {
+	var inFlight, maxInFlight int32
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		for {
+			m := atomic.LoadInt32(&maxInFlight)
+			if n <= m || atomic.CompareAndSwapInt32(&maxInFlight, m, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		atomic.AddInt32(&inFlight, -1)
+	}))
+	defer ts.Close()
+
+	limits := RateLimits{Application: RateLimit{MaxConcurrent: 2}}
+	endpoints := WithEndpoints(Endpoints{Application: ts.URL})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Each request uses its own Client; the limit is shared between them.
+			k, _ := NewClient(WithoutCredentials(), endpoints, WithRateLimits(limits))
+			k.Get(ts.URL + "/v1/applications/")
+			_, _, errs := k.End()
+			assert.Nil(t, errs)
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(2), atomic.LoadInt32(&maxInFlight))
+}
+
+func TestRateLimitSharedAndAdaptive(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer ts.Close()
+
+	k, _ := NewClient(WithoutCredentials(), WithEndpoints(Endpoints{Location: ts.URL}))
+	k.Get(ts.URL + "/v1/locations/")
+	k.End()
+
+	other, _ := NewClient(WithoutCredentials(), WithEndpoints(Endpoints{Location: ts.URL}))
+	other.Get(ts.URL + "/v1/locations/")
+
+	req, _ := other.prepareRequest(context.Background())
+	assert.True(t, k.limiter(req) == other.limiter(req), "clients with the same configuration share a limiter")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, _, errs := other.EndContext(ctx)
+	if assert.NotNil(t, errs) {
+		assert.Equal(t, context.DeadlineExceeded, errs[0], "the endpoint is paused after a 429")
+	}
+}
+
+func TestSweepLimiters(t *testing.T) {
+	idle := limiterFor("https://idle.example", RateLimit{})
+
+	busy := limiterFor("https://busy.example", RateLimit{})
+	release, err := busy.Wait(context.Background())
+	assert.Nil(t, err)
+
+	paused := limiterFor("https://paused.example", RateLimit{})
+	paused.Observe(&http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{"Retry-After": {"3600"}}})
+
+	limitersMu.Lock()
+	sweepLimiters(time.Now().Add(limiterIdle + time.Minute))
+	limitersMu.Unlock()
+
+	assert.True(t, limiterFor("https://idle.example", RateLimit{}) != idle, "an idle limiter is dropped")
+	assert.True(t, limiterFor("https://busy.example", RateLimit{}) == busy, "a limiter with a request in flight is kept")
+	assert.True(t, limiterFor("https://paused.example", RateLimit{}) == paused, "a paused limiter is kept")
+
+	release()
+	limitersMu.Lock()
+	sweepLimiters(time.Now().Add(limiterIdle + time.Minute))
+	limitersMu.Unlock()
+	assert.True(t, limiterFor("https://busy.example", RateLimit{}) != busy, "the limiter is dropped once its request completes")
+}
+
+func TestLoadRateLimits(t *testing.T) {
+	dir := testConfigDir(t)
+	defer os.RemoveAll(dir)
+
+	config := "[ratelimits]\napplication_rate=5\napplication_burst=10\nlocation_max_concurrent=2\n"
+	ioutil.WriteFile(dir+"/config", []byte(config), 0600)
+
+	assert.Equal(t, RateLimits{
+		Application: RateLimit{Rate: 5, Burst: 10},
+		Location:    RateLimit{MaxConcurrent: 2},
+	}, LoadRateLimits(dir+"/config", DefaultProfile))
+	assert.Equal(t, RateLimits{}, LoadRateLimits("fake-file.ini", DefaultProfile))
+}
@@ -0,0 +1,156 @@
+/*
+Copyright 2016 Kumoru.io
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kumoru
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy controls how a Client retries requests that fail with a transport
+// error or a retryable status code. Each attempt is rebuilt and re-signed, so it
+// carries a fresh X-Kumoru-Date.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first one.
+	MaxAttempts int
+	// MinBackoff is the base delay; the delay before attempt n is drawn uniformly
+	// from [0, MinBackoff*2^(n-2)], capped at MaxBackoff.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// RetryableStatus lists the response codes that are retried.
+	RetryableStatus []int
+	// RetryNonIdempotent also retries POST and PATCH requests, which may then be applied twice.
+	RetryNonIdempotent bool
+}
+
+// DefaultRetryPolicy returns a policy retrying idempotent requests up to four times
+// on connection failures, 429, 502, 503 and 504.
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:     4,
+		MinBackoff:      250 * time.Millisecond,
+		MaxBackoff:      10 * time.Second,
+		RetryableStatus: []int{http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+	}
+}
+
+// WithRetryPolicy sets the policy used to retry failed requests
+func WithRetryPolicy(policy *RetryPolicy) Option {
+	return func(k *Client) error {
+		k.Retry = policy
+		return nil
+	}
+}
+
+// next reports whether the attempt that produced resp and err should be retried
+// and how long to wait before doing so. now is the client's clock, against which
+// a Retry-After date is read.
+func (p *RetryPolicy) next(attempt int, req *http.Request, resp *http.Response, err error, now time.Time) (time.Duration, bool) {
+	if p == nil || attempt >= p.MaxAttempts {
+		return 0, false
+	}
+
+	if !p.RetryNonIdempotent && !isIdempotent(req.Method) {
+		return 0, false
+	}
+
+	if err != nil {
+		// The caller gave up; there is nothing to retry.
+		if req.Context().Err() != nil || err == context.Canceled || err == context.DeadlineExceeded {
+			return 0, false
+		}
+		return p.backoff(attempt), true
+	}
+
+	if !p.retryable(resp.StatusCode) {
+		return 0, false
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+		if wait, ok := retryAfter(resp, now); ok {
+			// Waiting longer than the policy allows is left to the caller.
+			if p.MaxBackoff > 0 && wait > p.MaxBackoff {
+				return 0, false
+			}
+			return wait, true
+		}
+	}
+
+	return p.backoff(attempt), true
+}
+
+func (p *RetryPolicy) retryable(status int) bool {
+	for _, s := range p.RetryableStatus {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff returns a fully jittered exponential delay for the attempt following attempt
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	ceiling := p.MinBackoff
+	for i := 1; i < attempt; i++ {
+		ceiling *= 2
+		if p.MaxBackoff > 0 && ceiling >= p.MaxBackoff {
+			ceiling = p.MaxBackoff
+			break
+		}
+	}
+
+	if ceiling <= 0 {
+		return 0
+	}
+
+	return time.Duration(rand.Int63n(int64(ceiling) + 1))
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case GET, HEAD, PUT, DELETE, "OPTIONS":
+		return true
+	}
+	return false
+}
+
+// retryAfter parses the Retry-After header, given either in seconds or as an http date
+func retryAfter(resp *http.Response, now time.Time) (time.Duration, bool) {
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(v); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if t, err := http.ParseTime(v); err == nil {
+		if wait := t.Sub(now); wait > 0 {
+			return wait, true
+		}
+		return 0, true
+	}
+
+	return 0, false
+}
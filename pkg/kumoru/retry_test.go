@@ -0,0 +1,168 @@
+/*
+Copyright 2016 Kumoru.io
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kumoru
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testRetryPolicy() *RetryPolicy {
+	p := DefaultRetryPolicy()
+	p.MinBackoff = time.Millisecond
+	p.MaxBackoff = 10 * time.Millisecond
+	return p
+}
+
+func TestRetryTransientStatus(t *testing.T) {
+	attempts := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if r.Header.Get("Authorization") == "" || r.Header.Get("X-Kumoru-Date") == "" {
+			t.Errorf("Expected attempt %d to be signed", attempts)
+		}
+		if attempts < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	k, _ := NewClient(WithCredentials("PUBLIC_TOKEN", "PRIVATE_TOKEN"), WithRole("ROLE_UUID"), WithRetryPolicy(testRetryPolicy()))
+	k.Get(ts.URL + "/v1/applications/")
+	k.SignRequest(true)
+	resp, body, errs := k.End()
+
+	assert.Nil(t, errs, "Expect no errors")
+	assert.Equal(t, 200, resp.StatusCode, "Expect the final attempt to succeed")
+	assert.Equal(t, "ok", body, "Expect body of the final attempt")
+	assert.Equal(t, 3, attempts, "Expect three attempts")
+}
+
+func TestRetryExhausted(t *testing.T) {
+	attempts := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	k, _ := NewClient(WithoutCredentials(), WithRetryPolicy(testRetryPolicy()))
+	k.Delete(ts.URL + "/v1/applications/foo")
+	resp, _, errs := k.End()
+
+	assert.Nil(t, errs, "Expect no errors")
+	assert.Equal(t, 503, resp.StatusCode, "Expect the last response to be returned")
+	assert.Equal(t, 4, attempts, "Expect MaxAttempts attempts")
+}
+
+func TestRetryNonIdempotent(t *testing.T) {
+	attempts := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	k, _ := NewClient(WithoutCredentials(), WithRetryPolicy(testRetryPolicy()))
+	k.Post(ts.URL + "/v1/applications/")
+	k.End()
+
+	assert.Equal(t, 1, attempts, "Expect POST not to be retried")
+
+	policy := testRetryPolicy()
+	policy.RetryNonIdempotent = true
+	k.SetRetryPolicy(policy)
+	attempts = 0
+	k.Post(ts.URL + "/v1/applications/")
+	k.End()
+
+	assert.Equal(t, 4, attempts, "Expect POST to be retried when allowed")
+}
+
+func TestRetryAfter(t *testing.T) {
+	attempts := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		if attempts == 2 {
+			w.Header().Set("Retry-After", "120")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+	}))
+	defer ts.Close()
+
+	k, _ := NewClient(WithoutCredentials(), WithRetryPolicy(testRetryPolicy()))
+	k.Get(ts.URL + "/v1/applications/")
+	resp, _, _ := k.End()
+
+	assert.Equal(t, 2, attempts, "Expect a Retry-After beyond MaxBackoff to stop retrying")
+	assert.Equal(t, 429, resp.StatusCode, "Expect the throttled response to be returned")
+}
+
+func TestRetryAfterClock(t *testing.T) {
+	now := time.Date(2016, 7, 11, 14, 42, 53, 0, time.UTC)
+
+	attempts := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.Header().Set("Retry-After", now.Add(120*time.Second).Format(http.TimeFormat))
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer ts.Close()
+
+	k, _ := NewClient(WithoutCredentials(), WithRetryPolicy(testRetryPolicy()), WithClock(func() time.Time { return now }))
+	k.Get(ts.URL + "/v1/applications/")
+	k.End()
+
+	assert.Equal(t, 1, attempts, "Expect a Retry-After date to be read against the client's clock")
+}
+
+func TestRetryAfterHeader(t *testing.T) {
+	now := time.Date(2016, 7, 11, 14, 42, 53, 0, time.UTC)
+
+	cases := []struct {
+		value    string
+		expected time.Duration
+		ok       bool
+	}{
+		{value: "", expected: 0, ok: false},
+		{value: "3", expected: 3 * time.Second, ok: true},
+		{value: "Mon, 11 Jul 2016 14:43:03 GMT", expected: 10 * time.Second, ok: true},
+		{value: "soon", expected: 0, ok: false},
+	}
+
+	for _, c := range cases {
+		resp := &http.Response{Header: http.Header{}}
+		resp.Header.Set("Retry-After", c.value)
+
+		wait, ok := retryAfter(resp, now)
+		if wait != c.expected || ok != c.ok {
+			t.Errorf("retryAfter(%q) == %v, %v, expected %v, %v", c.value, wait, ok, c.expected, c.ok)
+		}
+	}
+}
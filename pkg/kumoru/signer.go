@@ -0,0 +1,172 @@
+/*
+Copyright 2016 Kumoru.io
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kumoru
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/go-ini/ini"
+)
+
+// Signer signs requests on behalf of a Client
+type Signer interface {
+	// PublicToken returns the token identifying the key used to sign
+	PublicToken() string
+	// Sign returns the hex encoded signature of signingString
+	Sign(ctx context.Context, signingString string) (string, error)
+}
+
+// HMACSigner signs with HMAC-SHA256 keyed by the private token. It is used when a Client has no Signer.
+type HMACSigner Ktokens
+
+// PublicToken implements Signer
+func (s HMACSigner) PublicToken() string {
+	return s.Public
+}
+
+// Sign implements Signer
+func (s HMACSigner) Sign(ctx context.Context, signingString string) (string, error) {
+	return digest(s.Private, signingString), nil
+}
+
+// ExecSigner asks an external program which holds the private token to sign, so that the token
+// never enters this process.
+//
+// The program is run as "Command sign" with KUMORU_TOKEN_PUBLIC set to Public. It is given the
+// string to sign on stdin and must print the hex encoded HMAC-SHA256 of it to stdout.
+type ExecSigner struct {
+	Command string
+	Public  string
+}
+
+// PublicToken implements Signer
+func (s ExecSigner) PublicToken() string {
+	return s.Public
+}
+
+// Sign implements Signer
+func (s ExecSigner) Sign(ctx context.Context, signingString string) (string, error) {
+	args := strings.Fields(s.Command)
+	if len(args) == 0 {
+		return "", fmt.Errorf("kumoru: signer command is empty")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, HelperTimeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, args[0], append(args[1:], "sign")...)
+	cmd.Env = append(os.Environ(), "KUMORU_TOKEN_PUBLIC="+s.Public)
+	cmd.Stdin = strings.NewReader(signingString)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("kumoru: signer %s: %s: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+
+	signature := strings.TrimSpace(stdout.String())
+	if signature == "" {
+		return "", fmt.Errorf("kumoru: signer %s returned no signature", args[0])
+	}
+
+	return signature, nil
+}
+
+// SignerFromEnvironment returns an ExecSigner for the command in KUMORU_SIGNER, or nil if it is not set.
+// The public token is taken from KUMORU_TOKEN_PUBLIC or else the profile in filename, which need not hold a private token.
+func SignerFromEnvironment(filename, profile string) Signer {
+	command := os.Getenv("KUMORU_SIGNER")
+	if command == "" {
+		return nil
+	}
+
+	public := os.Getenv("KUMORU_TOKEN_PUBLIC")
+	if public == "" {
+		if config, err := ini.Load(filename); err == nil {
+			public = config.Section(ProfileSection(profile, "tokens")).Key("kumoru_token_public").String()
+		}
+	}
+
+	return ExecSigner{Command: command, Public: public}
+}
+
+// signer returns the Signer for k, defaulting to HMAC with k.Tokens
+func (k *Client) signer() Signer {
+	if k.Signer != nil {
+		return k.Signer
+	}
+
+	if k.Tokens == nil {
+		return HMACSigner{}
+	}
+
+	return HMACSigner(*k.Tokens)
+}
+
+// now returns the time requests are signed with
+func (k *Client) now() time.Time {
+	if k.Clock != nil {
+		return k.Clock()
+	}
+
+	return time.Now()
+}
+
+// WithSigner sets the Signer used to sign requests instead of the private token
+func WithSigner(s Signer) Option {
+	return func(k *Client) error {
+		k.Signer = s
+		return nil
+	}
+}
+
+// WithSigningVersion selects the signing scheme: 1, the default, or 2, which also covers
+// the host and query string, hashes the body with SHA-256 and carries a nonce against replay.
+func WithSigningVersion(version int) Option {
+	return func(k *Client) error {
+		if version != 1 && version != 2 {
+			return fmt.Errorf("kumoru: unknown signing version %d", version)
+		}
+
+		k.SigningVersion = version
+		return nil
+	}
+}
+
+// signingVersionFromEnvironment returns the signing version set by KUMORU_SIGNING_VERSION
+func signingVersionFromEnvironment() int {
+	if os.Getenv("KUMORU_SIGNING_VERSION") == "2" {
+		return 2
+	}
+
+	return 1
+}
+
+// WithClock sets the clock used to date signed requests
+func WithClock(clock func() time.Time) Option {
+	return func(k *Client) error {
+		k.Clock = clock
+		return nil
+	}
+}
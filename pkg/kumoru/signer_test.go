@@ -0,0 +1,134 @@
+/*
+Copyright 2016 Kumoru.io
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kumoru
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fixedSigner returns the same signature for everything and records what it was asked to sign
+type fixedSigner struct {
+	signed *[]string
+	err    error
+}
+
+func (s fixedSigner) PublicToken() string {
+	return "FIXED_PUBLIC"
+}
+
+func (s fixedSigner) Sign(ctx context.Context, signingString string) (string, error) {
+	*s.signed = append(*s.signed, signingString)
+	return "SIGNATURE", s.err
+}
+
+func fixedClock() time.Time {
+	return time.Date(2016, 7, 11, 14, 42, 53, 0, time.UTC)
+}
+
+func TestSigner(t *testing.T) {
+	var signed []string
+	k, err := NewClient(WithSigner(fixedSigner{signed: &signed}), WithRole("ROLE_UUID"), WithClock(fixedClock))
+	if !assert.Nil(t, err, "a signer stands in for the private token") {
+		return
+	}
+
+	k.Method = GET
+	k.URL = "https://application.example/v1/applications/"
+	k.SignRequest(true)
+
+	req, err := k.prepareRequest(context.Background())
+	if assert.Nil(t, err) {
+		assert.Equal(t, base64.StdEncoding.EncodeToString([]byte("FIXED_PUBLIC:SIGNATURE")), req.Header.Get("Authorization"))
+		assert.Equal(t, "11 Jul 16 14:42 +0000", req.Header.Get("X-Kumoru-Date"))
+		assert.Equal(t, []string{"GET\nx-kumoru-context:ROLE_UUID\nx-kumoru-date:11 Jul 16 14:42 +0000\n/v1/applications/"}, signed)
+	}
+
+	k.Signer = fixedSigner{signed: &signed, err: errors.New("agent unavailable")}
+	_, err = k.prepareRequest(context.Background())
+	assert.EqualError(t, err, "agent unavailable")
+
+	clone := k.Clone()
+	assert.Equal(t, k.Signer, clone.Signer)
+	assert.NotNil(t, clone.Clock)
+}
+
+func TestHMACSignerMatchesVerify(t *testing.T) {
+	k := testSignedClient("https://application.example/v1/applications/")
+	k.Method = GET
+	k.Signer = HMACSigner{Public: "PUBLIC_TOKEN", Private: "PRIVATE_TOKEN"}
+	k.Tokens = &Ktokens{}
+
+	req, err := k.prepareRequest(context.Background())
+	assert.Nil(t, err)
+
+	_, err = Verify(req, testKeyLookup)
+	assert.Nil(t, err)
+}
+
+func TestExecSigner(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("signer script requires a POSIX shell")
+	}
+
+	dir, err := ioutil.TempDir("", "kumoru")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	command := dir + "/signer"
+	script := fmt.Sprintf(`#!/bin/sh
+[ "$1" = sign ] || exit 2
+[ "$KUMORU_TOKEN_PUBLIC" = PUBLIC_TOKEN ] || exit 3
+cat > %s/signed
+echo 0123abcd
+`, dir)
+	ioutil.WriteFile(command, []byte(script), 0700)
+
+	s := ExecSigner{Command: command, Public: "PUBLIC_TOKEN"}
+	signature, err := s.Sign(context.Background(), "GET\n/v1/applications/")
+	assert.Nil(t, err)
+	assert.Equal(t, "0123abcd", signature)
+
+	signed, _ := ioutil.ReadFile(dir + "/signed")
+	assert.Equal(t, "GET\n/v1/applications/", string(signed))
+
+	_, err = ExecSigner{Command: command + " unexpected", Public: "PUBLIC_TOKEN"}.Sign(context.Background(), "")
+	assert.NotNil(t, err, "a failing signer is reported")
+
+	os.Clearenv()
+	defer os.Clearenv()
+	os.Setenv("KUMORU_SIGNER", command)
+
+	assert.Equal(t, ExecSigner{Command: command, Public: "PUBLIC_TOKEN"}, SignerFromEnvironment("example-cfg.ini", DefaultProfile))
+
+	os.Setenv("KUMORU_TOKEN_PUBLIC", "ENV_PUBLIC")
+	assert.Equal(t, "ENV_PUBLIC", SignerFromEnvironment("example-cfg.ini", DefaultProfile).PublicToken())
+
+	os.Unsetenv("KUMORU_SIGNER")
+	assert.Nil(t, SignerFromEnvironment("example-cfg.ini", DefaultProfile))
+}
@@ -0,0 +1,233 @@
+/*
+Copyright 2016 Kumoru.io
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kumoru
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// ForwardedContextHeader carries the X-Kumoru-Context of a proxied request in v2 signatures
+// so that a verifier can rebuild the string the proxying party signed. v1 does not send it.
+const ForwardedContextHeader = "X-Kumoru-Forwarded-Context"
+
+// Headers and algorithm name used by v2 signatures
+const (
+	SigningAlgorithmV2  = "KUMORU2-HMAC-SHA256"
+	ContentSHA256Header = "X-Kumoru-Content-SHA256"
+	NonceHeader         = "X-Kumoru-Nonce"
+)
+
+// emptySHA256 is the hex encoded SHA-256 digest of an empty body
+const emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// canonicalRequest holds the parts of a request covered by the Kumoru signature
+type canonicalRequest struct {
+	Method string
+	Path   string
+	Date   string
+
+	// HasBody is set for POST, PUT and PATCH, which sign the body digest and type.
+	HasBody     bool
+	ContentMD5  string
+	ContentType string
+
+	// Proxied is set when the request carries a Proxy-Authorization header.
+	Proxied            bool
+	ProxyAuthorization string
+	ForwardedContext   string
+
+	// HasContext is cleared for GET requests on /accounts/, which are signed without a role.
+	HasContext bool
+	Context    string
+}
+
+// String returns the string which is signed, one "name:value" line per header followed by the path
+func (c canonicalRequest) String() string {
+	s := c.Method + "\n"
+
+	if c.HasBody {
+		s += fmt.Sprintf("content-md5:%v\n", c.ContentMD5)
+		s += fmt.Sprintf("content-type:%v\n", c.ContentType)
+	}
+
+	if c.Proxied {
+		s += fmt.Sprintf("proxy-authorization:%v\n", c.ProxyAuthorization)
+
+		if c.ForwardedContext != "" {
+			s += fmt.Sprintf("x-kumoru-context:%v\n", c.ForwardedContext)
+		}
+	}
+
+	if c.HasContext {
+		s += "x-kumoru-context:" + c.Context + "\n"
+	}
+
+	return s + "x-kumoru-date:" + c.Date + "\n" + c.Path
+}
+
+// signsContext reports whether a request is signed with its X-Kumoru-Context.
+// There is a chicken and egg problem retrieving account information the first time.
+// The signing string cannot contain the context (RoleUUID) on the first request for account info.
+// Since the signing string logic is general purpose, it's easiest to skip this header for GET to .../accounts/...
+func signsContext(method, path string) bool {
+	return !(method == GET && strings.Contains(path, "/accounts/"))
+}
+
+// hasBody reports whether requests using method sign a body digest
+func hasBody(method string) bool {
+	switch method {
+	case POST, PUT, PATCH:
+		return true
+	}
+	return false
+}
+
+// digest returns the hex encoded HMAC-SHA256 of signingString keyed by privateToken
+func digest(privateToken, signingString string) string {
+	h := hmac.New(sha256.New, []byte(privateToken))
+	h.Write([]byte(signingString))
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// canonicalRequestV2 holds the parts of a request covered by a v2 signature.
+// Unlike v1 it covers the host and query string, hashes the body with SHA-256 and carries a nonce.
+type canonicalRequestV2 struct {
+	Method        string
+	Host          string
+	Path          string
+	Query         string
+	ContentType   string
+	ContentSHA256 string
+	Context       string
+	Date          string
+	Nonce         string
+
+	// Proxied is set when the request carries a Proxy-Authorization header.
+	Proxied            bool
+	ProxyAuthorization string
+	ForwardedContext   string
+}
+
+// newCanonicalRequestV2 reads the signed parts of req, which must already carry its v2 headers.
+// Clients and verifiers both use it so that they agree on the string signed.
+func newCanonicalRequestV2(req *http.Request) canonicalRequestV2 {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+
+	c := canonicalRequestV2{
+		Method:        req.Method,
+		Host:          host,
+		Path:          req.URL.EscapedPath(),
+		Query:         req.URL.RawQuery,
+		ContentType:   req.Header.Get("Content-Type"),
+		ContentSHA256: req.Header.Get(ContentSHA256Header),
+		Date:          req.Header.Get("X-Kumoru-Date"),
+		Nonce:         req.Header.Get(NonceHeader),
+	}
+
+	if signsContext(req.Method, req.URL.Path) {
+		c.Context = req.Header.Get("X-Kumoru-Context")
+	}
+
+	if _, ok := req.Header["Proxy-Authorization"]; ok {
+		c.Proxied = true
+		c.ProxyAuthorization = req.Header.Get("Proxy-Authorization")
+		c.ForwardedContext = req.Header.Get(ForwardedContextHeader)
+	}
+
+	return c
+}
+
+// String returns the string which is signed: the algorithm, method, lower case host, escaped path and
+// canonical query on their own lines, followed by one "name:value" line per signed header.
+// Every line is present even when its value is empty.
+func (c canonicalRequestV2) String() string {
+	lines := []string{
+		SigningAlgorithmV2,
+		c.Method,
+		strings.ToLower(c.Host),
+		c.Path,
+		canonicalQuery(c.Query),
+		"content-type:" + c.ContentType,
+		"x-kumoru-content-sha256:" + strings.ToLower(c.ContentSHA256),
+		"x-kumoru-context:" + c.Context,
+		"x-kumoru-date:" + c.Date,
+		"x-kumoru-nonce:" + c.Nonce,
+	}
+
+	if c.Proxied {
+		lines = append(lines,
+			"proxy-authorization:"+c.ProxyAuthorization,
+			"x-kumoru-forwarded-context:"+c.ForwardedContext,
+		)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// canonicalQuery sorts the parameters of rawQuery by name and then value, and escapes
+// each name and value as in RFC 3986: every byte except A-Z a-z 0-9 - . _ ~ is percent-encoded.
+func canonicalQuery(rawQuery string) string {
+	values, _ := url.ParseQuery(rawQuery)
+
+	var params [][2]string
+	for name, vs := range values {
+		for _, v := range vs {
+			params = append(params, [2]string{escapeRFC3986(name), escapeRFC3986(v)})
+		}
+	}
+
+	sort.Slice(params, func(i, j int) bool {
+		if params[i][0] != params[j][0] {
+			return params[i][0] < params[j][0]
+		}
+		return params[i][1] < params[j][1]
+	})
+
+	pairs := make([]string, len(params))
+	for i, p := range params {
+		pairs[i] = p[0] + "=" + p[1]
+	}
+
+	return strings.Join(pairs, "&")
+}
+
+func escapeRFC3986(s string) string {
+	return strings.Replace(url.QueryEscape(s), "+", "%20", -1)
+}
+
+// newNonce returns a random nonce for a v2 signature
+var newNonce = func() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// authorizationV2 formats the Authorization header of a v2 signature
+func authorizationV2(public, signature string) string {
+	return fmt.Sprintf("%s Credential=%s, Signature=%s", SigningAlgorithmV2, public, signature)
+}
@@ -0,0 +1,173 @@
+/*
+Copyright 2016 Kumoru.io
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kumoru
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// signingVector is an entry of testdata/signing-v2.json
+type signingVector struct {
+	Name             string            `json:"name"`
+	PublicToken      string            `json:"public_token"`
+	PrivateToken     string            `json:"private_token"`
+	Context          string            `json:"context"`
+	Method           string            `json:"method"`
+	URL              string            `json:"url"`
+	Body             string            `json:"body"`
+	Headers          map[string]string `json:"headers"`
+	CanonicalRequest string            `json:"canonical_request"`
+	Signature        string            `json:"signature"`
+	Authorization    string            `json:"authorization"`
+}
+
+func loadSigningVectors(t *testing.T) []signingVector {
+	b, err := ioutil.ReadFile("testdata/signing-v2.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var vectors []signingVector
+	if err := json.Unmarshal(b, &vectors); err != nil {
+		t.Fatal(err)
+	}
+	return vectors
+}
+
+// request builds the request described by v as a verifier would receive it
+func (v signingVector) request() *http.Request {
+	req, _ := http.NewRequest(v.Method, v.URL, strings.NewReader(v.Body))
+	for name, value := range v.Headers {
+		req.Header.Set(name, value)
+	}
+	req.Header.Set("Authorization", v.Authorization)
+	return req
+}
+
+func (v signingVector) date() time.Time {
+	d, _ := time.Parse(time.RFC3339, v.Headers["X-Kumoru-Date"])
+	return d
+}
+
+func TestSigningV2Vectors(t *testing.T) {
+	nonce := newNonce
+	defer func() { newNonce = nonce }()
+
+	targetTypes := map[string]string{
+		"":                                  "",
+		"application/json":                  "json",
+		"application/x-www-form-urlencoded": "form",
+	}
+
+	lookup := func(public string) (string, error) {
+		return "PRIVATE_TOKEN", nil
+	}
+	verifier := NewVerifier(lookup)
+
+	for _, v := range loadSigningVectors(t) {
+		k, err := NewClient(
+			WithCredentials(v.PublicToken, v.PrivateToken),
+			WithRole(v.Context),
+			WithClock(v.date),
+			WithSigningVersion(2),
+		)
+		if !assert.Nil(t, err, v.Name) {
+			continue
+		}
+
+		k.Method = v.Method
+		k.URL = v.URL
+		k.TargetType = targetTypes[v.Headers["Content-Type"]]
+		k.RawString = v.Body
+		k.SignRequest(true)
+		newNonce = func() string { return v.Headers["X-Kumoru-Nonce"] }
+
+		req, err := k.prepareRequest(context.Background())
+		if assert.Nil(t, err, v.Name) {
+			assert.Equal(t, v.CanonicalRequest, newCanonicalRequestV2(req).String(), v.Name)
+			assert.Equal(t, v.Authorization, req.Header.Get("Authorization"), v.Name)
+			for name, value := range v.Headers {
+				assert.Equal(t, value, req.Header.Get(name), v.Name+": "+name)
+			}
+		}
+
+		req = v.request()
+		assert.Equal(t, v.CanonicalRequest, newCanonicalRequestV2(req).String(), v.Name)
+		assert.Equal(t, v.Signature, digest(v.PrivateToken, v.CanonicalRequest), v.Name)
+
+		id, err := verifier.verify(req, lookup, v.date())
+		if assert.Nil(t, err, v.Name) {
+			assert.Equal(t, 2, id.SigningVersion)
+			assert.Equal(t, v.PublicToken, id.PublicToken)
+		}
+	}
+}
+
+func TestVerifyV2Rejects(t *testing.T) {
+	var post signingVector
+	for _, v := range loadSigningVectors(t) {
+		if v.Method == POST {
+			post = v
+		}
+	}
+
+	lookup := func(string) (string, error) { return "PRIVATE_TOKEN", nil }
+	verifier := NewVerifier(lookup)
+
+	tamper := func(f func(*http.Request)) error {
+		req := post.request()
+		f(req)
+		_, err := verifier.verify(req, lookup, post.date())
+		return err
+	}
+
+	assert.Equal(t, ErrSignatureMismatch, tamper(func(r *http.Request) { r.URL.RawQuery = "admin=true" }))
+	assert.Equal(t, ErrSignatureMismatch, tamper(func(r *http.Request) { r.Host = "evil.example" }))
+	assert.Equal(t, ErrContentSHA256Mismatch, tamper(func(r *http.Request) { r.Body = ioutil.NopCloser(strings.NewReader("{}")) }))
+	assert.Equal(t, ErrMalformedSignature, tamper(func(r *http.Request) { r.Header.Del(NonceHeader) }))
+	assert.Equal(t, ErrMalformedSignature, tamper(func(r *http.Request) { r.Header.Set("Authorization", SigningAlgorithmV2+" Credential=PUBLIC_TOKEN") }))
+
+	assert.Nil(t, tamper(func(*http.Request) {}))
+	assert.Equal(t, ErrReplayedRequest, tamper(func(*http.Request) {}), "a nonce is accepted once")
+
+	_, err := verifier.verify(post.request(), lookup, post.date().Add(SignatureWindow+time.Minute))
+	assert.Equal(t, ErrRequestExpired, err)
+}
+
+func TestCanonicalQuery(t *testing.T) {
+	cases := map[string]string{
+		"":                         "",
+		"b=2&a=1":                  "a=1&b=2",
+		"a=2&a=1&a-b=3":            "a=1&a=2&a-b=3",
+		"q=hello+world":            "q=hello%20world",
+		"q=%7e%2a":                 "q=~%2A",
+		"select_by=tag%3Dweb&x=":   "select_by=tag%3Dweb&x=",
+		"deployment_token=a/b%2Bc": "deployment_token=a%2Fb%2Bc",
+	}
+
+	for raw, expected := range cases {
+		assert.Equal(t, expected, canonicalQuery(raw), raw)
+	}
+}
@@ -0,0 +1,129 @@
+/*
+Copyright 2016 Kumoru.io
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kumoru
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// maxErrorBody limits how much of a failed streamed response is read into an *APIError
+const maxErrorBody = 64 << 10
+
+// SendReader streams body as the request content in place of anything passed to Send.
+// body is read once to compute Content-MD5 before it is sent, and is rewound to where it
+// started for every attempt, so it must be an io.ReadSeeker.
+func (k *Client) SendReader(body io.ReadSeeker) *Client {
+	k.BodyReader = body
+	return k
+}
+
+// EndStream sends the request and returns the response with its body unread, so that it
+// can be decoded incrementally. The caller must close the body.
+// A response with a 4xx or 5xx status is read, closed and returned with an *APIError.
+func (k *Client) EndStream() (*http.Response, error) {
+	return k.EndStreamContext(context.Background())
+}
+
+// EndStreamContext is like EndStream but the request is bound to ctx.
+func (k *Client) EndStreamContext(ctx context.Context) (*http.Response, error) {
+	if len(k.Errors) != 0 {
+		return nil, k.Errors[0]
+	}
+
+	k.streaming = true
+	defer func() { k.streaming = false }()
+
+	resp, err := k.send(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		return resp, k.CheckResponse(resp, body)
+	}
+
+	return resp, nil
+}
+
+// content returns the body of a POST, PUT or PATCH request
+func (k *Client) content() io.Reader {
+	if k.body != nil {
+		return ioutil.NopCloser(io.LimitReader(k.body.r, k.body.size))
+	}
+	return strings.NewReader(k.RawString)
+}
+
+// contentMD5 returns the hex encoded MD5 digest of the request body
+func (k *Client) contentMD5() string {
+	if k.body != nil {
+		return k.body.md5
+	}
+
+	md5Sum := md5.Sum([]byte(k.RawString))
+	return fmt.Sprintf("%x", md5Sum)
+}
+
+// contentSHA256 returns the hex encoded SHA-256 digest of the request body
+func (k *Client) contentSHA256() string {
+	if k.body != nil {
+		return k.body.sha256
+	}
+
+	sum := sha256.Sum256([]byte(k.RawString))
+	return fmt.Sprintf("%x", sum)
+}
+
+// requestBody is a streamed request body which can be rewound for each attempt
+type requestBody struct {
+	r      io.ReadSeeker
+	start  int64
+	size   int64
+	md5    string
+	sha256 string
+}
+
+// newRequestBody reads r once from its current offset to find its size and digest
+func newRequestBody(r io.ReadSeeker) (*requestBody, error) {
+	start, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+
+	h, h256 := md5.New(), sha256.New()
+	size, err := io.Copy(io.MultiWriter(h, h256), r)
+	if err != nil {
+		return nil, err
+	}
+
+	return &requestBody{r: r, start: start, size: size, md5: fmt.Sprintf("%x", h.Sum(nil)), sha256: fmt.Sprintf("%x", h256.Sum(nil))}, nil
+}
+
+// rewind moves the body back to where it started
+func (b *requestBody) rewind() error {
+	_, err := b.r.Seek(b.start, io.SeekStart)
+	return err
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2016 Kumoru.io
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kumoru
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSendReader(t *testing.T) {
+	payload := strings.Repeat("kumoru", 10000)
+	attempts := 0
+
+	ts := httptest.NewServer(VerifyHandler(testKeyLookup, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		body, _ := ioutil.ReadAll(r.Body)
+		if string(body) != payload {
+			t.Errorf("Expected attempt %d to send the whole body; got %d bytes", attempts, len(body))
+		}
+		if r.ContentLength != int64(len(payload)) {
+			t.Errorf("Expected content length %d; got %d", len(payload), r.ContentLength)
+		}
+		if attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	})))
+	defer ts.Close()
+
+	// The body is sent from wherever the reader was left, on every attempt.
+	offset := strings.NewReader("header" + payload)
+	offset.Seek(int64(len("header")), io.SeekStart)
+
+	cases := []io.ReadSeeker{
+		strings.NewReader(payload),
+		offset,
+	}
+
+	for _, body := range cases {
+		attempts = 0
+
+		k := testSignedClient(ts.URL + "/v1/artifacts/")
+		k.Method = PUT
+		k.TargetType = "text"
+		k.SendReader(body)
+		k.SetRetryPolicy(&RetryPolicy{MaxAttempts: 2, MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond, RetryableStatus: []int{503}})
+
+		resp, _, errs := k.End()
+		assert.Empty(t, errs)
+		assert.Equal(t, 200, resp.StatusCode)
+		assert.Equal(t, 2, attempts)
+	}
+}
+
+func TestEndStream(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message":"no such log"}`))
+			return
+		}
+
+		w.Write([]byte("line 1\n"))
+		w.(http.Flusher).Flush()
+		w.Write([]byte("line 2\n"))
+	}))
+	defer ts.Close()
+
+	k := New()
+	k.Get(ts.URL + "/logs")
+
+	resp, err := k.EndStreamContext(context.Background())
+	if assert.Nil(t, err) {
+		var buf bytes.Buffer
+		io.Copy(&buf, resp.Body)
+		resp.Body.Close()
+		assert.Equal(t, "line 1\nline 2\n", buf.String())
+	}
+
+	k.Get(ts.URL + "/missing")
+
+	resp, err = k.EndStream()
+	assert.True(t, IsNotFound(err))
+	assert.Equal(t, "no such log", err.(*APIError).Message)
+	assert.Equal(t, 404, resp.StatusCode)
+}
@@ -17,7 +17,7 @@ limitations under the License.
 package kumoru
 
 import (
-	"os"
+	"strings"
 
 	"github.com/go-ini/ini"
 )
@@ -43,7 +43,8 @@ func LoadRole(filename string, section string) (string, error) {
 	return ini.Key("role_uuid").String(), nil
 }
 
-// LoadTokens from a file returning a struct of type Ktokens
+// LoadTokens from a file returning a struct of type Ktokens.
+// An encrypted private token is decrypted, asking PassphraseFunc for the passphrase if needed.
 func LoadTokens(filename string, section string) (Ktokens, error) {
 	config, err := ini.Load(filename)
 	if err != nil {
@@ -55,44 +56,43 @@ func LoadTokens(filename string, section string) (Ktokens, error) {
 		return Ktokens{}, err
 	}
 
-	return Ktokens{
+	tokens := Ktokens{
 		Public:  iniTokens.Key("kumoru_token_public").String(),
 		Private: iniTokens.Key("kumoru_token_private").String(),
-	}, nil
+	}
+
+	if strings.HasPrefix(tokens.Private, encryptedPrefix) {
+		if tokens.Private, err = openToken(filename, tokens.Public, tokens.Private); err != nil {
+			return Ktokens{}, err
+		}
+	}
+
+	return tokens, nil
 
 }
 
 // SaveRole writes the active role to a file
 func SaveRole(directory, filename, section string, roleUUID string) error {
-	kfile := directory + filename
-
-	config, err := ini.Load(kfile)
-
-	if err != nil {
-		os.Mkdir(directory, 0755)
-		config = ini.Empty()
-		config.NewSection(section)
-	}
-
-	config.Section(section).NewKey("role_uuid", roleUUID)
-	return config.SaveTo(kfile)
+	return updateConfig(directory, filename, func(config *ini.File) {
+		config.Section(section).Key("role_uuid").SetValue(roleUUID)
+	})
 }
 
-// SaveTokens writes tokens to a file
+// SaveTokens writes tokens to a file, encrypting the private token if section uses the encrypted store
 func SaveTokens(directory, filename, section string, tokens Ktokens) error {
-	kfile := directory + filename
+	if TokenStore(directory+filename, section) == TokenStoreEncrypted {
+		passphrase, err := PassphraseFunc(directory+filename, true)
+		if err != nil {
+			return err
+		}
 
-	config, err := ini.Load(kfile)
-
-	if err != nil {
-		os.Mkdir(directory, 0755)
-		config = ini.Empty()
-		config.NewSection(section)
+		return SaveEncryptedTokens(directory, filename, section, tokens, passphrase)
 	}
 
-	config.Section(section).NewKey("kumoru_token_public", tokens.Public)
-	config.Section(section).NewKey("kumoru_token_private", tokens.Private)
-	return config.SaveTo(kfile)
+	return updateConfig(directory, filename, func(config *ini.File) {
+		config.Section(section).Key("kumoru_token_public").SetValue(tokens.Public)
+		config.Section(section).Key("kumoru_token_private").SetValue(tokens.Private)
+	})
 }
 
 // HasTokens checks a file to make sure there are tokens stored
@@ -0,0 +1,351 @@
+/*
+Copyright 2016 Kumoru.io
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kumoru
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-ini/ini"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	// TokenStorePlain and TokenStoreEncrypted are the values of the token_store key of a tokens section.
+	TokenStorePlain     = "plain"
+	TokenStoreEncrypted = "encrypted"
+
+	// encryptedPrefix marks a kumoru_token_private value as sealed by the encrypted store
+	encryptedPrefix = "kumoru-enc:"
+)
+
+// ErrWrongPassphrase is returned when an encrypted private token cannot be decrypted
+var ErrWrongPassphrase = errors.New("kumoru: wrong passphrase or corrupted token store")
+
+// scrypt cost parameters for newly sealed tokens; the parameters used are stored with each token.
+var (
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+// PassphraseFunc returns the passphrase for the encrypted token store in store.
+// confirm is true when a passphrase is being chosen for new tokens.
+// The default reads KUMORU_PASSPHRASE; the CLI replaces it with a terminal prompt.
+var PassphraseFunc = func(store string, confirm bool) ([]byte, error) {
+	if p := os.Getenv("KUMORU_PASSPHRASE"); p != "" {
+		return []byte(p), nil
+	}
+
+	return nil, fmt.Errorf("kumoru: tokens in %s are encrypted; set KUMORU_PASSPHRASE", store)
+}
+
+// SessionTTL is how long a key derived from a passphrase is cached in $XDG_RUNTIME_DIR, so that a shell session
+// is not prompted by every command. It can be set with KUMORU_SESSION_TTL; zero disables the cache.
+// Without $XDG_RUNTIME_DIR keys are only kept in memory by the process which derived them.
+var SessionTTL = 15 * time.Minute
+
+// sealedToken is the encoding of an encrypted private token
+type sealedToken struct {
+	KDF        string `json:"kdf"`
+	N          int    `json:"n"`
+	R          int    `json:"r"`
+	P          int    `json:"p"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+var openedTokens = struct {
+	sync.Mutex
+	m map[string]string
+}{m: map[string]string{}}
+
+// TokenStore returns the token store configured for section of filename
+func TokenStore(filename, section string) string {
+	config, err := ini.Load(filename)
+	if err != nil {
+		return TokenStorePlain
+	}
+
+	if config.Section(section).Key("token_store").String() == TokenStoreEncrypted {
+		return TokenStoreEncrypted
+	}
+
+	return TokenStorePlain
+}
+
+// SaveEncryptedTokens writes tokens to a file with the private token encrypted by a key derived from passphrase,
+// and selects the encrypted store for section. The public token is kept in plaintext and authenticated with the private one.
+func SaveEncryptedTokens(directory, filename, section string, tokens Ktokens, passphrase []byte) error {
+	sealed, err := sealToken(tokens.Public, tokens.Private, passphrase)
+	if err != nil {
+		return err
+	}
+
+	return updateConfig(directory, filename, func(config *ini.File) {
+		config.Section(section).Key("token_store").SetValue(TokenStoreEncrypted)
+		config.Section(section).Key("kumoru_token_public").SetValue(tokens.Public)
+		config.Section(section).Key("kumoru_token_private").SetValue(sealed)
+	})
+}
+
+// sealToken encrypts private with AES-256-GCM under a scrypt key, using public as additional data
+func sealToken(public, private string, passphrase []byte) (string, error) {
+	s := sealedToken{KDF: "scrypt", N: scryptN, R: scryptR, P: scryptP, Salt: make([]byte, 16)}
+	if _, err := rand.Read(s.Salt); err != nil {
+		return "", err
+	}
+
+	key, err := s.key(passphrase)
+	if err != nil {
+		return "", err
+	}
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", err
+	}
+
+	s.Nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(s.Nonce); err != nil {
+		return "", err
+	}
+	s.Ciphertext = aead.Seal(nil, s.Nonce, []byte(private), []byte(public))
+
+	b, err := json.Marshal(s)
+	if err != nil {
+		return "", err
+	}
+
+	saveSessionKey(s.Salt, key)
+
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(b), nil
+}
+
+// openToken decrypts a value written by sealToken, asking PassphraseFunc for the passphrase
+// unless the token was already opened by this process or its key is cached for the session.
+func openToken(store, public, value string) (string, error) {
+	openedTokens.Lock()
+	defer openedTokens.Unlock()
+
+	if private, ok := openedTokens.m[public+value]; ok {
+		return private, nil
+	}
+
+	var s sealedToken
+	b, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, encryptedPrefix))
+	if err == nil {
+		err = json.Unmarshal(b, &s)
+	}
+	if err != nil || s.KDF != "scrypt" {
+		return "", fmt.Errorf("kumoru: malformed encrypted token in %s", store)
+	}
+
+	private, err := s.open(loadSessionKey(s.Salt), public)
+	if err != nil {
+		passphrase, err := PassphraseFunc(store, false)
+		if err != nil {
+			return "", err
+		}
+
+		key, err := s.key(passphrase)
+		if err != nil {
+			return "", err
+		}
+
+		if private, err = s.open(key, public); err != nil {
+			return "", err
+		}
+
+		saveSessionKey(s.Salt, key)
+	}
+
+	openedTokens.m[public+value] = private
+	return private, nil
+}
+
+func (s sealedToken) key(passphrase []byte) ([]byte, error) {
+	return scrypt.Key(passphrase, s.Salt, s.N, s.R, s.P, 32)
+}
+
+func (s sealedToken) open(key []byte, public string) (string, error) {
+	if key == nil {
+		return "", ErrWrongPassphrase
+	}
+
+	aead, err := newAEAD(key)
+	if err != nil || len(s.Nonce) != aead.NonceSize() {
+		return "", ErrWrongPassphrase
+	}
+
+	private, err := aead.Open(nil, s.Nonce, s.Ciphertext, []byte(public))
+	if err != nil {
+		return "", ErrWrongPassphrase
+	}
+
+	return string(private), nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// sessionTTL returns SessionTTL, overridden by KUMORU_SESSION_TTL
+func sessionTTL() time.Duration {
+	if v := os.Getenv("KUMORU_SESSION_TTL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			return d
+		}
+	}
+
+	return SessionTTL
+}
+
+// errNoSessionDir is returned by sessionDir when there is no per-user runtime directory
+var errNoSessionDir = errors.New("kumoru: XDG_RUNTIME_DIR is not set")
+
+// sessionDir returns $XDG_RUNTIME_DIR/kumoru, creating it if needed. The runtime directory is memory backed
+// and removed at logout; keys are never cached in the system temporary directory, which is usually on disk.
+// The directory must belong to the current user and be unreadable by others.
+func sessionDir() (string, error) {
+	runtime := os.Getenv("XDG_RUNTIME_DIR")
+	if runtime == "" {
+		return "", errNoSessionDir
+	}
+
+	dir := filepath.Join(runtime, "kumoru")
+	if err := os.MkdirAll(dir, ConfigDirMode); err != nil {
+		return "", err
+	}
+
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() || info.Mode().Perm()&0077 != 0 {
+		return "", fmt.Errorf("kumoru: %s is not a private directory", dir)
+	}
+	if uid, ok := fileOwner(info); ok && uid != os.Getuid() {
+		return "", fmt.Errorf("kumoru: %s belongs to another user", dir)
+	}
+
+	return dir, nil
+}
+
+// sessionKeyFile names the cache file for the key derived with salt
+func sessionKeyFile(salt []byte) (string, error) {
+	dir, err := sessionDir()
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(salt)
+	return filepath.Join(dir, hex.EncodeToString(sum[:16])), nil
+}
+
+// loadSessionKey returns the cached key for salt, or nil if there is none or it has expired
+func loadSessionKey(salt []byte) []byte {
+	ttl := sessionTTL()
+	if ttl <= 0 {
+		return nil
+	}
+
+	name, err := sessionKeyFile(salt)
+	if err != nil {
+		return nil
+	}
+
+	info, err := os.Stat(name)
+	if err != nil {
+		return nil
+	}
+	if time.Since(info.ModTime()) > ttl {
+		os.Remove(name)
+		return nil
+	}
+
+	key, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil
+	}
+
+	return key
+}
+
+// saveSessionKey caches key for salt. Failures are ignored since the passphrase can always be asked for again.
+func saveSessionKey(salt, key []byte) {
+	if sessionTTL() <= 0 {
+		return
+	}
+
+	name, err := sessionKeyFile(salt)
+	if err != nil {
+		return
+	}
+
+	removeExpiredSessionKeys(filepath.Dir(name))
+
+	ioutil.WriteFile(name, key, ConfigFileMode)
+	os.Chtimes(name, time.Now(), time.Now())
+}
+
+// removeExpiredSessionKeys deletes the keys in dir older than the session TTL, so that keys which are
+// never read again do not outlive their session
+func removeExpiredSessionKeys(dir string) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return
+	}
+
+	ttl := sessionTTL()
+	for _, f := range files {
+		if f.Mode().IsRegular() && time.Since(f.ModTime()) > ttl {
+			os.Remove(filepath.Join(dir, f.Name()))
+		}
+	}
+}
+
+// ForgetSession removes all cached keys, so that the passphrase is asked for again
+func ForgetSession() error {
+	dir, err := sessionDir()
+	if err == errNoSessionDir {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	return os.RemoveAll(dir)
+}
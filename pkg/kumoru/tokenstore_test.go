@@ -0,0 +1,174 @@
+/*
+Copyright 2016 Kumoru.io
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kumoru
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testTokenStore lowers the scrypt cost, isolates the session cache and answers passphrase prompts with passphrase.
+// The returned function restores the defaults.
+func testTokenStore(t *testing.T, passphrase string) (string, func()) {
+	dir := testConfigDir(t)
+	n, prompt := scryptN, PassphraseFunc
+
+	scryptN = 1 << 10
+	os.Setenv("XDG_RUNTIME_DIR", dir)
+	setPassphrase(passphrase)
+	forgetOpenedTokens()
+
+	return dir, func() {
+		scryptN, PassphraseFunc = n, prompt
+		os.Unsetenv("XDG_RUNTIME_DIR")
+		forgetOpenedTokens()
+		os.RemoveAll(dir)
+	}
+}
+
+func setPassphrase(passphrase string) {
+	PassphraseFunc = func(store string, confirm bool) ([]byte, error) {
+		if passphrase == "" {
+			return nil, errors.New("no passphrase")
+		}
+		return []byte(passphrase), nil
+	}
+}
+
+func forgetOpenedTokens() {
+	openedTokens.Lock()
+	openedTokens.m = map[string]string{}
+	openedTokens.Unlock()
+}
+
+func TestSaveEncryptedTokens(t *testing.T) {
+	dir, restore := testTokenStore(t, "correct horse")
+	defer restore()
+
+	assert.Nil(t, SaveEncryptedTokens(dir+"/", "config", "tokens", Ktokens{Public: "PUBLIC", Private: "PRIVATE"}, []byte("correct horse")))
+
+	raw, _ := ioutil.ReadFile(dir + "/config")
+	assert.Contains(t, string(raw), "PUBLIC")
+	assert.NotContains(t, string(raw), "PRIVATE")
+	assert.Equal(t, TokenStoreEncrypted, TokenStore(dir+"/config", "tokens"))
+	assert.True(t, HasTokens(dir+"/config", "tokens"))
+
+	ForgetSession()
+	tokens, err := LoadTokens(dir+"/config", "tokens")
+	assert.Nil(t, err)
+	assert.Equal(t, Ktokens{Public: "PUBLIC", Private: "PRIVATE"}, tokens)
+
+	ForgetSession()
+	forgetOpenedTokens()
+	setPassphrase("wrong")
+	_, err = LoadTokens(dir+"/config", "tokens")
+	assert.Equal(t, ErrWrongPassphrase, err)
+
+	_, err = FileCredentials{Filename: dir + "/config"}.Credentials()
+	assert.Equal(t, ErrWrongPassphrase, err, "decryption errors are not hidden by the chain")
+}
+
+func TestEncryptedTokensAuthenticatePublicToken(t *testing.T) {
+	dir, restore := testTokenStore(t, "correct horse")
+	defer restore()
+
+	assert.Nil(t, SaveEncryptedTokens(dir+"/", "config", "tokens", Ktokens{Public: "PUBLIC", Private: "PRIVATE"}, []byte("correct horse")))
+
+	raw, _ := ioutil.ReadFile(dir + "/config")
+	ioutil.WriteFile(dir+"/config", []byte(strings.Replace(string(raw), "PUBLIC", "OTHER", 1)), ConfigFileMode)
+
+	_, err := LoadTokens(dir+"/config", "tokens")
+	assert.Equal(t, ErrWrongPassphrase, err)
+}
+
+func TestSaveTokensKeepsEncryptedStore(t *testing.T) {
+	dir, restore := testTokenStore(t, "correct horse")
+	defer restore()
+
+	assert.Nil(t, SaveEncryptedTokens(dir+"/", "config", "tokens", Ktokens{Public: "PUBLIC", Private: "PRIVATE"}, []byte("correct horse")))
+	assert.Nil(t, SaveTokens(dir+"/", "config", "tokens", Ktokens{Public: "NEW_PUBLIC", Private: "NEW_PRIVATE"}))
+
+	raw, _ := ioutil.ReadFile(dir + "/config")
+	assert.NotContains(t, string(raw), "NEW_PRIVATE")
+
+	tokens, err := LoadTokens(dir+"/config", "tokens")
+	assert.Nil(t, err)
+	assert.Equal(t, "NEW_PRIVATE", tokens.Private)
+
+	setPassphrase("")
+	assert.NotNil(t, SaveTokens(dir+"/", "config", "tokens", Ktokens{Public: "PUBLIC", Private: "PRIVATE"}))
+}
+
+func TestSessionKeyCache(t *testing.T) {
+	dir, restore := testTokenStore(t, "correct horse")
+	defer restore()
+
+	assert.Nil(t, SaveEncryptedTokens(dir+"/", "config", "tokens", Ktokens{Public: "PUBLIC", Private: "PRIVATE"}, []byte("correct horse")))
+
+	setPassphrase("")
+	tokens, err := LoadTokens(dir+"/config", "tokens")
+	assert.Nil(t, err, "the key is cached for the session")
+	assert.Equal(t, "PRIVATE", tokens.Private)
+
+	forgetOpenedTokens()
+	files, _ := ioutil.ReadDir(dir + "/kumoru")
+	if assert.Len(t, files, 1) {
+		assert.Equal(t, ConfigFileMode, files[0].Mode().Perm())
+		old := time.Now().Add(-SessionTTL - time.Minute)
+		os.Chtimes(dir+"/kumoru/"+files[0].Name(), old, old)
+	}
+	_, err = LoadTokens(dir+"/config", "tokens")
+	assert.NotNil(t, err, "expired keys are not used")
+
+	os.Setenv("KUMORU_SESSION_TTL", "0")
+	defer os.Unsetenv("KUMORU_SESSION_TTL")
+	setPassphrase("correct horse")
+	_, err = LoadTokens(dir+"/config", "tokens")
+	assert.Nil(t, err)
+	files, _ = ioutil.ReadDir(dir + "/kumoru")
+	assert.Len(t, files, 0, "a zero TTL disables the cache")
+}
+
+func TestSessionKeyCacheLocation(t *testing.T) {
+	dir, restore := testTokenStore(t, "correct horse")
+	defer restore()
+
+	os.MkdirAll(dir+"/kumoru", ConfigDirMode)
+	stale := dir + "/kumoru/stale"
+	ioutil.WriteFile(stale, []byte("KEY"), ConfigFileMode)
+	old := time.Now().Add(-SessionTTL - time.Minute)
+	os.Chtimes(stale, old, old)
+
+	assert.Nil(t, SaveEncryptedTokens(dir+"/", "config", "tokens", Ktokens{Public: "PUBLIC", Private: "PRIVATE"}, []byte("correct horse")))
+	_, err := os.Stat(stale)
+	assert.True(t, os.IsNotExist(err), "expired keys are removed when a key is saved")
+
+	os.Chmod(dir+"/kumoru", 0755)
+	_, err = sessionDir()
+	assert.NotNil(t, err, "a directory readable by others is not used")
+
+	os.Unsetenv("XDG_RUNTIME_DIR")
+	_, err = sessionDir()
+	assert.Equal(t, errNoSessionDir, err, "keys are not cached in the temporary directory")
+	assert.Nil(t, ForgetSession())
+}
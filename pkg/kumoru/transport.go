@@ -0,0 +1,168 @@
+/*
+Copyright 2016 Kumoru.io
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kumoru
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+var (
+	sharedTransport     *http.Transport
+	sharedTransportOnce sync.Once
+
+	trustTransports   = map[string]*http.Transport{}
+	trustTransportsMu sync.Mutex
+)
+
+// DefaultTransport returns the transport shared by every Client which has not been
+// given its own. It trusts the system and embedded Kumoru root certificates, honors
+// HTTP_PROXY/HTTPS_PROXY/NO_PROXY and keeps idle connections open for reuse.
+func DefaultTransport() *http.Transport {
+	sharedTransportOnce.Do(func() {
+		config, _ := DefaultTrust().TLSConfig()
+		sharedTransport = newTransport(config, http.ProxyFromEnvironment)
+	})
+	return sharedTransport
+}
+
+// transportFor returns a pooling transport implementing t. Transports are shared
+// between Clients using the same trust configuration.
+func transportFor(t TrustConfig) (*http.Transport, error) {
+	key := fmt.Sprintf("%#v", t)
+	if key == fmt.Sprintf("%#v", DefaultTrust()) {
+		return DefaultTransport(), nil
+	}
+
+	trustTransportsMu.Lock()
+	defer trustTransportsMu.Unlock()
+
+	if tr, ok := trustTransports[key]; ok {
+		return tr, nil
+	}
+
+	config, err := t.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	tr := newTransport(config, http.ProxyFromEnvironment)
+	trustTransports[key] = tr
+	return tr, nil
+}
+
+// failingTransport fails every request with err. It stands in for a transport
+// which could not be configured so that requests are never sent with weaker settings.
+type failingTransport struct {
+	err error
+}
+
+func (f failingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return nil, f.err
+}
+
+// newTransport builds a pooling transport using config and proxy
+func newTransport(config *tls.Config, proxy func(*http.Request) (*url.URL, error)) *http.Transport {
+	return &http.Transport{
+		Proxy: proxy,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSClientConfig:       config,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   10,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+}
+
+// httpClient returns the http.Client used to send a request. A Transport set on
+// k.Client by the caller is used as is; otherwise k.Transport is used.
+func (k *Client) httpClient() *http.Client {
+	c := http.Client{}
+	if k.Client != nil {
+		c = *k.Client
+	}
+
+	if c.Transport == nil {
+		if k.Transport != nil {
+			c.Transport = k.Transport
+		} else {
+			c.Transport = DefaultTransport()
+		}
+	}
+
+	return &c
+}
+
+// proxy returns the proxy function of k's transport, falling back to the environment
+func (k *Client) proxy() func(*http.Request) (*url.URL, error) {
+	if k.Transport != nil && k.Transport.Proxy != nil {
+		return k.Transport.Proxy
+	}
+	return http.ProxyFromEnvironment
+}
+
+// tlsConfig returns the TLS configuration of k's transport
+func (k *Client) tlsConfig() *tls.Config {
+	if k.Transport != nil && k.Transport.TLSClientConfig != nil {
+		return k.Transport.TLSClientConfig
+	}
+	config, _ := DefaultTrust().TLSConfig()
+	return config
+}
+
+// SetProxy sets the function used to pick a proxy for each request. A nil
+// function disables proxying.
+func (k *Client) SetProxy(proxy func(*http.Request) (*url.URL, error)) {
+	k.Transport = newTransport(k.tlsConfig(), proxy)
+}
+
+// WithTransport sends every request through rt instead of the shared transport
+func WithTransport(rt http.RoundTripper) Option {
+	return func(k *Client) error {
+		if rt == nil {
+			return errors.New("kumoru: transport must not be nil")
+		}
+		k.Client.Transport = rt
+		return nil
+	}
+}
+
+// WithTLSConfig sets the TLS configuration used to reach the api endpoints
+func WithTLSConfig(config *tls.Config) Option {
+	return func(k *Client) error {
+		k.TLSClientConfig(config)
+		return nil
+	}
+}
+
+// WithProxy sets the function used to pick a proxy for each request
+func WithProxy(proxy func(*http.Request) (*url.URL, error)) Option {
+	return func(k *Client) error {
+		k.SetProxy(proxy)
+		return nil
+	}
+}
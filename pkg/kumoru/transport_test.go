@@ -0,0 +1,116 @@
+/*
+Copyright 2016 Kumoru.io
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kumoru
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransportReusesConnections(t *testing.T) {
+	var conns int32
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("[]"))
+	}))
+	ts.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+	ts.Start()
+	defer ts.Close()
+
+	k, _ := NewClient(WithoutCredentials())
+
+	for i := 0; i < 10; i++ {
+		c := k.Clone()
+		c.Get(ts.URL + "/v1/applications/")
+		_, _, errs := c.End()
+		assert.Nil(t, errs, "Expect no errors")
+	}
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&conns), "Expect a single pooled connection")
+}
+
+func TestTransportTLSClientConfig(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	k, _ := NewClient(WithoutCredentials())
+	k.Get(ts.URL + "/v1/applications/")
+	_, _, errs := k.End()
+	assert.NotNil(t, errs, "Expect the test certificate to be untrusted by default")
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ts.Certificate())
+
+	k, _ = NewClient(WithoutCredentials(), WithTLSConfig(&tls.Config{RootCAs: pool}))
+	k.Get(ts.URL + "/v1/applications/")
+	_, _, errs = k.End()
+	assert.Nil(t, errs, "Expect the configured pool to be used")
+
+	assert.NotEqual(t, DefaultTransport(), k.Transport, "Expect the shared transport to be left untouched")
+}
+
+func TestTransportProxy(t *testing.T) {
+	var proxied int32
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&proxied, 1)
+		if r.URL.Host != "application.example.com" {
+			t.Errorf("Expected proxied host %q; got %q", "application.example.com", r.URL.Host)
+		}
+	}))
+	defer proxy.Close()
+
+	proxyURL, _ := url.Parse(proxy.URL)
+
+	k, _ := NewClient(WithoutCredentials(), WithProxy(http.ProxyURL(proxyURL)))
+	k.Get("http://application.example.com/v1/applications/")
+	_, _, errs := k.End()
+
+	assert.Nil(t, errs, "Expect no errors")
+	assert.Equal(t, int32(1), atomic.LoadInt32(&proxied), "Expect the request to go through the proxy")
+}
+
+type countingTransport struct {
+	calls int
+}
+
+func (c *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	c.calls++
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestTransportCallerProvided(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	rt := &countingTransport{}
+	k, _ := NewClient(WithoutCredentials(), WithTransport(rt))
+	k.Get(ts.URL + "/v1/applications/")
+	k.End()
+
+	assert.Equal(t, 1, rt.calls, "Expect the caller's transport to be used")
+}
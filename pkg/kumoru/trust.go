@@ -0,0 +1,186 @@
+/*
+Copyright 2016 Kumoru.io
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kumoru
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/kumoru/kumoru-sdk-go/RootCAs"
+)
+
+// TrustConfig describes the certificates a Client accepts from the api endpoints.
+// The certificates embedded in RootCAs are always trusted.
+type TrustConfig struct {
+	// SystemRoots adds the operating system's trust store.
+	SystemRoots bool
+	// CABundle is the path of a PEM file holding additional trusted certificates,
+	// such as a corporate proxy CA or the CA of a self-hosted installation.
+	CABundle string
+	// PinnedSPKI lists base64 encoded SHA-256 digests of SubjectPublicKeyInfo
+	// ("sha256/" prefix optional). When set, the server's chain must contain one of them.
+	PinnedSPKI []string
+	// Insecure disables certificate verification. It is meant for local testing only.
+	Insecure bool
+	// ClientCertificate is presented to servers which request one, such as mTLS gateways.
+	ClientCertificate ClientCertificate
+}
+
+// DefaultTrust trusts the system roots and the embedded Kumoru roots
+func DefaultTrust() TrustConfig {
+	return TrustConfig{SystemRoots: true}
+}
+
+// TrustFromEnvironment returns DefaultTrust amended by KUMORU_CA_BUNDLE,
+// KUMORU_TLS_PINS (comma separated), KUMORU_TLS_INSECURE and ClientCertificateFromEnvironment.
+func TrustFromEnvironment() TrustConfig {
+	t := DefaultTrust()
+	t.CABundle = os.Getenv("KUMORU_CA_BUNDLE")
+	t.ClientCertificate = ClientCertificateFromEnvironment()
+
+	for _, pin := range strings.Split(os.Getenv("KUMORU_TLS_PINS"), ",") {
+		if pin = strings.TrimSpace(pin); pin != "" {
+			t.PinnedSPKI = append(t.PinnedSPKI, pin)
+		}
+	}
+
+	if strings.ToLower(os.Getenv("KUMORU_TLS_INSECURE")) == "true" {
+		t.Insecure = true
+	}
+
+	return t
+}
+
+// TLSConfig builds a tls.Config implementing t
+func (t TrustConfig) TLSConfig() (*tls.Config, error) {
+	var pool *x509.CertPool
+
+	if t.SystemRoots {
+		if systemPool, err := x509.SystemCertPool(); err == nil {
+			pool = systemPool
+		}
+	}
+
+	if pool == nil {
+		pool = x509.NewCertPool()
+	}
+
+	pool.AppendCertsFromPEM(RootCAs.AlphaSSLCA)
+	pool.AppendCertsFromPEM(RootCAs.LetsEncryptCA)
+	pool.AppendCertsFromPEM(RootCAs.ISRGRootX1)
+
+	if t.CABundle != "" {
+		bundle, err := ioutil.ReadFile(t.CABundle)
+		if err != nil {
+			return nil, fmt.Errorf("kumoru: reading CA bundle: %s", err)
+		}
+
+		if !pool.AppendCertsFromPEM(bundle) {
+			return nil, fmt.Errorf("kumoru: no certificates found in CA bundle %s", t.CABundle)
+		}
+	}
+
+	config := &tls.Config{
+		RootCAs:            pool,
+		InsecureSkipVerify: t.Insecure,
+	}
+
+	if !t.ClientCertificate.IsZero() {
+		r, err := newCertificateReloader(t.ClientCertificate)
+		if err != nil {
+			return nil, err
+		}
+
+		config.GetClientCertificate = r.GetClientCertificate
+	}
+
+	if len(t.PinnedSPKI) > 0 {
+		pins := map[string]bool{}
+		for _, pin := range t.PinnedSPKI {
+			pin = strings.TrimPrefix(pin, "sha256/")
+			if digest, err := base64.StdEncoding.DecodeString(pin); err != nil || len(digest) != sha256.Size {
+				return nil, fmt.Errorf("kumoru: invalid SPKI pin %q", pin)
+			}
+			pins[pin] = true
+		}
+
+		config.VerifyPeerCertificate = verifyPins(pins)
+	}
+
+	return config, nil
+}
+
+// verifyPins returns a VerifyPeerCertificate callback requiring a pinned key in the chain.
+// The presented certificates are checked when verification is disabled.
+func verifyPins(pins map[string]bool) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+		var certs []*x509.Certificate
+
+		for _, chain := range verifiedChains {
+			certs = append(certs, chain...)
+		}
+
+		if len(verifiedChains) == 0 {
+			for _, raw := range rawCerts {
+				cert, err := x509.ParseCertificate(raw)
+				if err != nil {
+					return err
+				}
+				certs = append(certs, cert)
+			}
+		}
+
+		for _, cert := range certs {
+			digest := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+			if pins[base64.StdEncoding.EncodeToString(digest[:])] {
+				return nil
+			}
+		}
+
+		return fmt.Errorf("kumoru: no pinned public key found in the certificate chain")
+	}
+}
+
+// SPKIPin returns the pin of cert in the format accepted by TrustConfig.PinnedSPKI
+func SPKIPin(cert *x509.Certificate) string {
+	digest := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(digest[:])
+}
+
+// SetTrust configures the certificates k accepts from the api endpoints
+func (k *Client) SetTrust(t TrustConfig) error {
+	tr, err := transportFor(t)
+	if err != nil {
+		return err
+	}
+
+	k.Transport = tr
+	return nil
+}
+
+// WithTrust configures the certificates the Client accepts from the api endpoints
+func WithTrust(t TrustConfig) Option {
+	return func(k *Client) error {
+		return k.SetTrust(t)
+	}
+}
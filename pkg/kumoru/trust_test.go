@@ -0,0 +1,115 @@
+/*
+Copyright 2016 Kumoru.io
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kumoru
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeBundle(t *testing.T, ts *httptest.Server) string {
+	dir, err := ioutil.TempDir("", "kumoru-trust")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bundle := filepath.Join(dir, "ca.pem")
+	pemBytes := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw})
+	if err := ioutil.WriteFile(bundle, pemBytes, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return bundle
+}
+
+func trustedGet(k *Client, url string) []error {
+	k.Get(url + "/v1/applications/")
+	_, _, errs := k.End()
+	return errs
+}
+
+func TestTrustCABundle(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	bundle := writeBundle(t, ts)
+	defer os.RemoveAll(filepath.Dir(bundle))
+
+	k, err := NewClient(WithoutCredentials(), WithTrust(TrustConfig{SystemRoots: true, CABundle: bundle}))
+	assert.Nil(t, err, "Expect no error")
+	assert.Nil(t, trustedGet(k, ts.URL), "Expect the bundle to be trusted")
+
+	_, err = NewClient(WithoutCredentials(), WithTrust(TrustConfig{CABundle: "fake-file.pem"}))
+	assert.NotNil(t, err, "Expect a missing bundle to be an error")
+}
+
+func TestTrustPinning(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	bundle := writeBundle(t, ts)
+	defer os.RemoveAll(filepath.Dir(bundle))
+
+	k, _ := NewClient(WithoutCredentials(), WithTrust(TrustConfig{CABundle: bundle, PinnedSPKI: []string{"sha256/" + SPKIPin(ts.Certificate())}}))
+	assert.Nil(t, trustedGet(k, ts.URL), "Expect the pinned key to be accepted")
+
+	k, _ = NewClient(WithoutCredentials(), WithTrust(TrustConfig{CABundle: bundle, PinnedSPKI: []string{"47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU="}}))
+	assert.NotNil(t, trustedGet(k, ts.URL), "Expect an unpinned key to be rejected")
+
+	_, err := NewClient(WithoutCredentials(), WithTrust(TrustConfig{PinnedSPKI: []string{"not-a-pin"}}))
+	assert.NotNil(t, err, "Expect an invalid pin to be an error")
+}
+
+func TestTrustInsecure(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	k, _ := NewClient(WithoutCredentials(), WithTrust(TrustConfig{Insecure: true}))
+	assert.Nil(t, trustedGet(k, ts.URL), "Expect verification to be skipped")
+}
+
+func TestTrustFromEnvironment(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	bundle := writeBundle(t, ts)
+	defer os.RemoveAll(filepath.Dir(bundle))
+
+	os.Clearenv()
+	os.Setenv("KUMORU_CONFIG", "example-cfg.ini")
+	os.Setenv("KUMORU_CA_BUNDLE", bundle)
+	os.Setenv("KUMORU_TLS_PINS", " sha256/"+SPKIPin(ts.Certificate())+" ,")
+
+	trust := TrustFromEnvironment()
+	assert.Equal(t, bundle, trust.CABundle, "Expect bundle to match")
+	assert.Equal(t, 1, len(trust.PinnedSPKI), "Expect a single pin")
+	assert.True(t, trust.SystemRoots, "Expect system roots to be trusted")
+
+	assert.Nil(t, trustedGet(New(), ts.URL), "Expect New to use the environment bundle")
+
+	os.Setenv("KUMORU_CA_BUNDLE", "fake-file.pem")
+	assert.NotNil(t, trustedGet(New(), ts.URL), "Expect an unusable bundle to fail every request")
+
+	os.Clearenv()
+}
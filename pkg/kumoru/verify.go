@@ -0,0 +1,523 @@
+/*
+Copyright 2016 Kumoru.io
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kumoru
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SignatureWindow is how far the X-Kumoru-Date of a signed request may be from the verifier's clock
+const SignatureWindow = 15 * time.Minute
+
+// DefaultMaxBodyBytes is the largest body a Verifier reads to check its digest unless MaxBodyBytes is set
+const DefaultMaxBodyBytes = 10 << 20
+
+var (
+	ErrMissingSignature      = errors.New("kumoru: request is not signed")
+	ErrMalformedSignature    = errors.New("kumoru: malformed request signature")
+	ErrUnknownKey            = errors.New("kumoru: unknown public token")
+	ErrSignatureMismatch     = errors.New("kumoru: request signature does not match")
+	ErrRequestExpired        = errors.New("kumoru: request date is outside the signature window")
+	ErrContentMD5Mismatch    = errors.New("kumoru: content-md5 does not match the request body")
+	ErrMalformedProxyChain   = errors.New("kumoru: malformed proxy-authorization header")
+	ErrContentSHA256Mismatch = errors.New("kumoru: x-kumoru-content-sha256 does not match the request body")
+	ErrReplayedRequest       = errors.New("kumoru: request nonce has already been used")
+	ErrBodyTooLarge          = errors.New("kumoru: request body is too large to verify")
+)
+
+// KeyLookup returns the private token paired with publicToken.
+// It should return ErrUnknownKey when publicToken is not recognised.
+type KeyLookup func(publicToken string) (privateToken string, err error)
+
+// Identity describes the signer of a verified request
+type Identity struct {
+	PublicToken string
+	// RoleUUID is the X-Kumoru-Context the request was signed with, if any.
+	RoleUUID string
+	Date     time.Time
+	// ForwardedContext is the X-Kumoru-Context of the proxied request, if any.
+	ForwardedContext string
+	// Chain lists the requests this one was made on behalf of, nearest first.
+	Chain []ProxyHop
+	// SigningVersion is 1 or 2.
+	SigningVersion int
+}
+
+// ProxyHop is one request decoded from a Proxy-Authorization header.
+// Its signature is not checked; it is vouched for by the party which proxied it.
+type ProxyHop struct {
+	PublicToken string
+	Signature   string
+	Method      string
+	Path        string
+	ContentMD5  string
+	ContentType string
+	Date        string
+}
+
+// Verifier checks the Kumoru signature of requests, using KeyLookup to find the signer's private token.
+// It remembers the nonces of the v2 requests it accepts, so each Verifier rejects replays of requests
+// it has seen; share one between the handlers of a service.
+type Verifier struct {
+	KeyLookup KeyLookup
+	// MaxBodyBytes caps the bodies read to check their digest; larger requests fail with ErrBodyTooLarge.
+	// Zero means DefaultMaxBodyBytes.
+	MaxBodyBytes int64
+
+	nonces *nonceCache
+}
+
+// NewVerifier returns a Verifier which uses keyLookup to find the signer's private token
+func NewVerifier(keyLookup KeyLookup) *Verifier {
+	return &Verifier{KeyLookup: keyLookup, nonces: newNonceCache()}
+}
+
+// defaultVerifier holds the nonces seen by Verify
+var defaultVerifier = NewVerifier(nil)
+
+// Verify checks the Kumoru signature of req, using keyLookup to find the signer's private token.
+// The body of POST, PUT and PATCH requests is read to check its Content-MD5 and then restored.
+// Version 2 signatures are also accepted; their body is checked against X-Kumoru-Content-SHA256
+// and each nonce is accepted once within SignatureWindow by all callers of Verify.
+func Verify(req *http.Request, keyLookup KeyLookup) (*Identity, error) {
+	return defaultVerifier.verify(req, keyLookup, time.Now())
+}
+
+// Verify checks the Kumoru signature of req as the package level Verify does,
+// accepting each v2 nonce once within SignatureWindow.
+func (v *Verifier) Verify(req *http.Request) (*Identity, error) {
+	return v.verify(req, v.KeyLookup, time.Now())
+}
+
+func (v *Verifier) maxBodyBytes() int64 {
+	if v.MaxBodyBytes > 0 {
+		return v.MaxBodyBytes
+	}
+	return DefaultMaxBodyBytes
+}
+
+func (v *Verifier) verify(req *http.Request, keyLookup KeyLookup, now time.Time) (*Identity, error) {
+	if req.Header.Get("Authorization") == "" {
+		return nil, ErrMissingSignature
+	}
+
+	if strings.HasPrefix(req.Header.Get("Authorization"), SigningAlgorithmV2+" ") {
+		return v.verifyV2(req, keyLookup, now)
+	}
+
+	public, signature, err := splitAuthorization(req.Header.Get("Authorization"))
+	if err != nil {
+		return nil, err
+	}
+
+	date, err := time.Parse(time.RFC822Z, req.Header.Get("X-Kumoru-Date"))
+	if err != nil {
+		return nil, ErrMalformedSignature
+	}
+
+	if skew := now.Sub(date); skew > SignatureWindow || skew < -SignatureWindow {
+		return nil, ErrRequestExpired
+	}
+
+	c := canonicalRequest{
+		Method:     req.Method,
+		Path:       req.URL.Path,
+		Date:       req.Header.Get("X-Kumoru-Date"),
+		HasBody:    hasBody(req.Method),
+		HasContext: signsContext(req.Method, req.URL.Path),
+		Context:    req.Header.Get("X-Kumoru-Context"),
+	}
+
+	if c.HasBody {
+		c.ContentMD5 = req.Header.Get("Content-MD5")
+		c.ContentType = req.Header.Get("Content-Type")
+	}
+
+	// v1 sends the forwarded context of a proxied request in X-Kumoru-Context, where the request's own
+	// context replaces it when that is signed too. Only a forwarded context equal to the request's own
+	// can then be recovered; proxies which forward other roles should sign with v2.
+	forwarded := []string{""}
+	if _, ok := req.Header["Proxy-Authorization"]; ok {
+		c.Proxied = true
+		c.ProxyAuthorization = req.Header.Get("Proxy-Authorization")
+
+		if role := req.Header.Get("X-Kumoru-Context"); role != "" {
+			if c.HasContext {
+				forwarded = append(forwarded, role)
+			} else {
+				forwarded = []string{role}
+			}
+		}
+	}
+
+	private, err := keyLookup(public)
+	if err != nil {
+		return nil, err
+	}
+
+	verified := false
+	for _, c.ForwardedContext = range forwarded {
+		expected := digest(private, c.String())
+		if hmac.Equal([]byte(expected), []byte(strings.ToLower(signature))) {
+			verified = true
+			break
+		}
+	}
+
+	if !verified {
+		return nil, ErrSignatureMismatch
+	}
+
+	if c.HasBody {
+		if err := checkContentMD5(req, v.maxBodyBytes()); err != nil {
+			return nil, err
+		}
+	}
+
+	id := &Identity{
+		PublicToken:      public,
+		Date:             date,
+		ForwardedContext: c.ForwardedContext,
+		SigningVersion:   1,
+	}
+
+	if c.HasContext {
+		id.RoleUUID = c.Context
+	}
+
+	if c.ProxyAuthorization != "" {
+		id.Chain, err = decodeProxyChain(c.ProxyAuthorization)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return id, nil
+}
+
+func (v *Verifier) verifyV2(req *http.Request, keyLookup KeyLookup, now time.Time) (*Identity, error) {
+	public, signature, err := splitAuthorizationV2(req.Header.Get("Authorization"))
+	if err != nil {
+		return nil, err
+	}
+
+	date, err := time.Parse(time.RFC3339, req.Header.Get("X-Kumoru-Date"))
+	if err != nil || req.Header.Get(NonceHeader) == "" || req.Header.Get(ContentSHA256Header) == "" {
+		return nil, ErrMalformedSignature
+	}
+
+	if skew := now.Sub(date); skew > SignatureWindow || skew < -SignatureWindow {
+		return nil, ErrRequestExpired
+	}
+
+	c := newCanonicalRequestV2(req)
+
+	private, err := keyLookup(public)
+	if err != nil {
+		return nil, err
+	}
+
+	expected := digest(private, c.String())
+	if !hmac.Equal([]byte(expected), []byte(strings.ToLower(signature))) {
+		return nil, ErrSignatureMismatch
+	}
+
+	body, err := readBody(req, v.maxBodyBytes())
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.EqualFold(c.ContentSHA256, fmt.Sprintf("%x", sha256.Sum256(body))) {
+		return nil, ErrContentSHA256Mismatch
+	}
+
+	if !v.nonces.use(public+":"+c.Nonce, now) {
+		return nil, ErrReplayedRequest
+	}
+
+	id := &Identity{
+		PublicToken:      public,
+		RoleUUID:         c.Context,
+		Date:             date,
+		ForwardedContext: c.ForwardedContext,
+		SigningVersion:   2,
+	}
+
+	if c.ProxyAuthorization != "" {
+		id.Chain, err = decodeProxyChain(c.ProxyAuthorization)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return id, nil
+}
+
+// splitAuthorizationV2 parses an Authorization header of the form
+// "KUMORU2-HMAC-SHA256 Credential=public, Signature=digest"
+func splitAuthorizationV2(header string) (string, string, error) {
+	var public, signature string
+
+	for _, field := range strings.Split(strings.TrimPrefix(header, SigningAlgorithmV2+" "), ",") {
+		kv := strings.SplitN(strings.TrimSpace(field), "=", 2)
+		if len(kv) != 2 {
+			return "", "", ErrMalformedSignature
+		}
+
+		switch kv[0] {
+		case "Credential":
+			public = kv[1]
+		case "Signature":
+			signature = kv[1]
+		}
+	}
+
+	if public == "" || signature == "" {
+		return "", "", ErrMalformedSignature
+	}
+
+	return public, signature, nil
+}
+
+// nonceCache remembers the nonces of verified v2 requests until they fall outside SignatureWindow
+type nonceCache struct {
+	sync.Mutex
+	seen map[string]time.Time
+	// order lists nonces as they were recorded, which is also the order in which they expire.
+	order []nonceEntry
+}
+
+type nonceEntry struct {
+	nonce   string
+	expires time.Time
+}
+
+func newNonceCache() *nonceCache {
+	return &nonceCache{seen: make(map[string]time.Time)}
+}
+
+// use records nonce and reports whether it had not been seen before
+func (n *nonceCache) use(nonce string, now time.Time) bool {
+	n.Lock()
+	defer n.Unlock()
+
+	for len(n.order) > 0 && now.After(n.order[0].expires) {
+		oldest := n.order[0]
+		if n.seen[oldest.nonce] == oldest.expires {
+			delete(n.seen, oldest.nonce)
+		}
+		n.order = n.order[1:]
+	}
+
+	if expires, ok := n.seen[nonce]; ok && !now.After(expires) {
+		return false
+	}
+
+	// A request dated up to SignatureWindow ahead stays valid for twice the window.
+	expires := now.Add(2 * SignatureWindow)
+	n.seen[nonce] = expires
+	n.order = append(n.order, nonceEntry{nonce: nonce, expires: expires})
+	return true
+}
+
+// splitAuthorization decodes an Authorization header of the form base64(public:digest)
+func splitAuthorization(header string) (string, string, error) {
+	decoded, err := base64.StdEncoding.DecodeString(header)
+	if err != nil {
+		return "", "", ErrMalformedSignature
+	}
+
+	parts := strings.SplitN(string(decoded), ":", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", ErrMalformedSignature
+	}
+
+	return parts[0], parts[1], nil
+}
+
+// checkContentMD5 compares the Content-MD5 header of req with the digest of its body, then restores the body
+func checkContentMD5(req *http.Request, limit int64) error {
+	body, err := readBody(req, limit)
+	if err != nil {
+		return err
+	}
+
+	md5Sum := md5.Sum(body)
+	if !strings.EqualFold(req.Header.Get("Content-MD5"), fmt.Sprintf("%x", md5Sum)) {
+		return ErrContentMD5Mismatch
+	}
+
+	return nil
+}
+
+// readBody reads the body of req, up to limit bytes, and replaces it so that it can be read again
+func readBody(req *http.Request, limit int64) ([]byte, error) {
+	var body []byte
+
+	if req.ContentLength > limit {
+		return nil, ErrBodyTooLarge
+	}
+
+	if req.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(http.MaxBytesReader(nil, req.Body, limit))
+		req.Body.Close()
+		if err != nil {
+			// MaxBytesReader stops with an error once limit bytes have been read.
+			if int64(len(body)) == limit {
+				return nil, ErrBodyTooLarge
+			}
+			return nil, err
+		}
+	}
+
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// decodeProxyChain unpacks a header built by genProxyRequestHeader and any Proxy-Authorization nested within it
+func decodeProxyChain(header string) ([]ProxyHop, error) {
+	var chain []ProxyHop
+
+	for header != "" {
+		decoded, err := base64.StdEncoding.DecodeString(header)
+		if err != nil {
+			return nil, ErrMalformedProxyChain
+		}
+
+		parts := strings.SplitN(string(decoded), ":", 3)
+		if len(parts) != 3 {
+			return nil, ErrMalformedProxyChain
+		}
+
+		components, err := base64.StdEncoding.DecodeString(parts[2])
+		if err != nil {
+			return nil, ErrMalformedProxyChain
+		}
+
+		lines := strings.Split(string(components), "\n")
+		if len(lines) < 3 {
+			return nil, ErrMalformedProxyChain
+		}
+
+		hop := ProxyHop{
+			PublicToken: parts[0],
+			Signature:   parts[1],
+			Method:      lines[0],
+			Path:        lines[len(lines)-1],
+		}
+
+		header = ""
+		for _, line := range lines[1 : len(lines)-1] {
+			kv := strings.SplitN(line, ":", 2)
+			if len(kv) != 2 {
+				return nil, ErrMalformedProxyChain
+			}
+
+			switch kv[0] {
+			case "content-md5":
+				hop.ContentMD5 = kv[1]
+			case "content-type":
+				hop.ContentType = kv[1]
+			case "date", "x-kumoru-date":
+				hop.Date = kv[1]
+			case "proxy-authorization":
+				header = kv[1]
+			}
+		}
+
+		chain = append(chain, hop)
+	}
+
+	return chain, nil
+}
+
+type contextKey int
+
+const identityKey contextKey = iota
+
+// IdentityFromContext returns the Identity stored by VerifyHandler, if any
+func IdentityFromContext(ctx context.Context) (*Identity, bool) {
+	id, ok := ctx.Value(identityKey).(*Identity)
+	return id, ok
+}
+
+// VerifyHandler returns an http.Handler which calls next only for requests that pass Verify.
+// The handler has a Verifier of its own, so it keeps its own record of nonces.
+func VerifyHandler(keyLookup KeyLookup, next http.Handler) http.Handler {
+	return NewVerifier(keyLookup).Handler(next)
+}
+
+// Handler returns an http.Handler which calls next only for requests that pass v.Verify.
+// The signer's Identity is available to next through IdentityFromContext.
+// Rejected requests get a JSON error body which CheckResponse decodes into an *APIError.
+func (v *Verifier) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := v.Verify(r)
+		if err != nil {
+			writeVerifyError(w, err)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), identityKey, id)))
+	})
+}
+
+func writeVerifyError(w http.ResponseWriter, err error) {
+	status, code := http.StatusUnauthorized, "invalid_signature"
+
+	switch err {
+	case ErrMissingSignature:
+		code = "missing_signature"
+	case ErrUnknownKey:
+		code = "unknown_key"
+	case ErrRequestExpired:
+		code = "request_expired"
+	case ErrReplayedRequest:
+		code = "replayed_request"
+	case ErrBodyTooLarge:
+		status, code = http.StatusRequestEntityTooLarge, "body_too_large"
+	case ErrContentMD5Mismatch:
+		status, code = http.StatusBadRequest, "content_md5_mismatch"
+	case ErrContentSHA256Mismatch:
+		status, code = http.StatusBadRequest, "content_sha256_mismatch"
+	case ErrMalformedProxyChain:
+		status, code = http.StatusBadRequest, "malformed_proxy_authorization"
+	case ErrMalformedSignature, ErrSignatureMismatch:
+	default:
+		status, code = http.StatusInternalServerError, "internal_error"
+	}
+
+	body, _ := json.Marshal(map[string]string{"code": code, "message": err.Error()})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(body)
+}
@@ -0,0 +1,265 @@
+/*
+Copyright 2016 Kumoru.io
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kumoru
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testKeyLookup(public string) (string, error) {
+	if public == "PUBLIC_TOKEN" {
+		return "PRIVATE_TOKEN", nil
+	}
+	if public == "UPSTREAM_TOKEN" {
+		return "UPSTREAM_PRIVATE", nil
+	}
+	return "", ErrUnknownKey
+}
+
+func testSignedClient(url string) *Client {
+	k := New()
+	k.Tokens = &Ktokens{Public: "PUBLIC_TOKEN", Private: "PRIVATE_TOKEN"}
+	k.RoleUUID = "ROLE_UUID"
+	k.URL = url
+	k.SignRequest(true)
+	return k
+}
+
+func TestVerify(t *testing.T) {
+	k := testSignedClient("https://application.example/v1/applications/")
+	k.Method = GET
+
+	req, err := k.prepareRequest(context.Background())
+	assert.Nil(t, err)
+
+	id, err := Verify(req, testKeyLookup)
+	if assert.Nil(t, err) {
+		assert.Equal(t, "PUBLIC_TOKEN", id.PublicToken)
+		assert.Equal(t, "ROLE_UUID", id.RoleUUID)
+		assert.Empty(t, id.Chain)
+	}
+}
+
+func TestVerifyBody(t *testing.T) {
+	k := testSignedClient("https://application.example/v1/applications/")
+	k.Method = POST
+	k.TargetType = "json"
+	k.RawString = `{"name":"app"}`
+
+	req, err := k.prepareRequest(context.Background())
+	assert.Nil(t, err)
+
+	_, err = Verify(req, testKeyLookup)
+	assert.Nil(t, err)
+
+	body, _ := ioutil.ReadAll(req.Body)
+	assert.Equal(t, `{"name":"app"}`, string(body), "body is restored for the next handler")
+
+	req, _ = k.prepareRequest(context.Background())
+	req.Body = ioutil.NopCloser(strings.NewReader(`{"name":"other"}`))
+
+	_, err = Verify(req, testKeyLookup)
+	assert.Equal(t, ErrContentMD5Mismatch, err)
+}
+
+func TestVerifyRejects(t *testing.T) {
+	k := testSignedClient("https://application.example/v1/applications/")
+	k.Method = GET
+
+	req, _ := k.prepareRequest(context.Background())
+	req.Header.Set("X-Kumoru-Context", "OTHER_ROLE")
+	_, err := Verify(req, testKeyLookup)
+	assert.Equal(t, ErrSignatureMismatch, err)
+
+	req, _ = k.prepareRequest(context.Background())
+	_, err = defaultVerifier.verify(req, testKeyLookup, time.Now().Add(20*time.Minute))
+	assert.Equal(t, ErrRequestExpired, err)
+
+	k.Tokens = &Ktokens{Public: "STRANGER", Private: "PRIVATE_TOKEN"}
+	req, _ = k.prepareRequest(context.Background())
+	_, err = Verify(req, testKeyLookup)
+	assert.Equal(t, ErrUnknownKey, err)
+
+	req.Header.Del("Authorization")
+	_, err = Verify(req, testKeyLookup)
+	assert.Equal(t, ErrMissingSignature, err)
+
+	req.Header.Set("Authorization", "not base64")
+	_, err = Verify(req, testKeyLookup)
+	assert.Equal(t, ErrMalformedSignature, err)
+}
+
+func TestVerifyAccountsWithoutContext(t *testing.T) {
+	k := testSignedClient("https://authorization.example/v1/accounts/foo@example.com")
+	k.Method = GET
+
+	req, _ := k.prepareRequest(context.Background())
+	assert.Equal(t, "", req.Header.Get("X-Kumoru-Context"))
+
+	id, err := Verify(req, testKeyLookup)
+	if assert.Nil(t, err) {
+		assert.Equal(t, "", id.RoleUUID)
+	}
+}
+
+func TestVerifyProxyChain(t *testing.T) {
+	upstream := testSignedClient("https://application.example/v1/applications/")
+	upstream.Tokens = &Ktokens{Public: "UPSTREAM_TOKEN", Private: "UPSTREAM_PRIVATE"}
+	upstream.RoleUUID = "ROLE_UUID"
+	upstream.Method = PUT
+	upstream.TargetType = "json"
+	upstream.RawString = `{}`
+
+	original, _ := upstream.prepareRequest(context.Background())
+
+	k := testSignedClient("https://authorization.example/v1/resources/")
+	k.Method = GET
+	k.ProxyRequest(original)
+
+	req, _ := k.prepareRequest(context.Background())
+	assert.Equal(t, "ROLE_UUID", req.Header.Get("X-Kumoru-Context"))
+	assert.Equal(t, "", req.Header.Get(ForwardedContextHeader), "v1 headers are unchanged")
+
+	id, err := Verify(req, testKeyLookup)
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	assert.Equal(t, "ROLE_UUID", id.ForwardedContext)
+	if assert.Len(t, id.Chain, 1) {
+		hop := id.Chain[0]
+		assert.Equal(t, "UPSTREAM_TOKEN", hop.PublicToken)
+		assert.Equal(t, PUT, hop.Method)
+		assert.Equal(t, "/v1/applications/", hop.Path)
+		assert.Equal(t, "application/json", hop.ContentType)
+		assert.Equal(t, original.Header.Get("Content-MD5"), hop.ContentMD5)
+		assert.Equal(t, original.Header.Get("X-Kumoru-Date"), hop.Date)
+	}
+
+	req.Header.Set("X-Kumoru-Context", "OTHER_ROLE")
+	_, err = Verify(req, testKeyLookup)
+	assert.Equal(t, ErrSignatureMismatch, err)
+}
+
+func TestVerifyProxyChainV2(t *testing.T) {
+	upstream := testSignedClient("https://application.example/v1/applications/")
+	upstream.Tokens = &Ktokens{Public: "UPSTREAM_TOKEN", Private: "UPSTREAM_PRIVATE"}
+	upstream.RoleUUID = "UPSTREAM_ROLE"
+	upstream.Method = GET
+
+	original, _ := upstream.prepareRequest(context.Background())
+
+	k := testSignedClient("https://authorization.example/v1/resources/")
+	k.SigningVersion = 2
+	k.Method = GET
+	k.ProxyRequest(original)
+
+	req, _ := k.prepareRequest(context.Background())
+	assert.Equal(t, "ROLE_UUID", req.Header.Get("X-Kumoru-Context"))
+	assert.Equal(t, "UPSTREAM_ROLE", req.Header.Get(ForwardedContextHeader))
+
+	id, err := Verify(req, testKeyLookup)
+	if assert.Nil(t, err) {
+		assert.Equal(t, "UPSTREAM_ROLE", id.ForwardedContext)
+		assert.Len(t, id.Chain, 1)
+	}
+
+	req.Header.Set(NonceHeader, "ANOTHER_NONCE")
+	req.Header.Set(ForwardedContextHeader, "OTHER_ROLE")
+	_, err = Verify(req, testKeyLookup)
+	assert.Equal(t, ErrSignatureMismatch, err)
+}
+
+func TestVerifyHandler(t *testing.T) {
+	ts := httptest.NewServer(VerifyHandler(testKeyLookup, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, ok := IdentityFromContext(r.Context())
+		if !ok {
+			t.Errorf("Expected an identity in the request context")
+			return
+		}
+		json.NewEncoder(w).Encode(id)
+	})))
+	defer ts.Close()
+
+	k := testSignedClient(ts.URL + "/v1/applications/")
+	k.Method = GET
+
+	resp, body, errs := k.End()
+	assert.Empty(t, errs)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Contains(t, body, `"RoleUUID":"ROLE_UUID"`)
+
+	k = testSignedClient(ts.URL + "/v1/applications/")
+	k.Method = GET
+	k.Tokens.Private = "WRONG"
+
+	resp, body, _ = k.End()
+	err := k.CheckResponse(resp, []byte(body))
+	assert.True(t, IsUnauthorized(err))
+	assert.Equal(t, "invalid_signature", err.(*APIError).Code)
+}
+
+func TestNonceCache(t *testing.T) {
+	n := newNonceCache()
+	now := time.Now()
+
+	assert.True(t, n.use("a", now))
+	assert.False(t, n.use("a", now.Add(time.Minute)), "a nonce is accepted once")
+	assert.True(t, n.use("b", now.Add(time.Minute)))
+
+	later := now.Add(2*SignatureWindow + 30*time.Second)
+	assert.True(t, n.use("a", later), "expired nonces are forgotten")
+	assert.Len(t, n.seen, 2)
+	assert.Len(t, n.order, 2)
+	assert.False(t, n.use("b", later), "only expired nonces are forgotten")
+}
+
+func TestVerifyBodyLimit(t *testing.T) {
+	v := NewVerifier(testKeyLookup)
+	v.MaxBodyBytes = 8
+	ts := httptest.NewServer(v.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+	defer ts.Close()
+
+	k := testSignedClient(ts.URL + "/v1/applications/")
+	k.Method = POST
+	k.TargetType = "json"
+	k.RawString = `{"name":"web"}`
+
+	resp, body, errs := k.End()
+	assert.Empty(t, errs)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+	assert.Contains(t, body, "body_too_large")
+
+	req, _ := http.NewRequest(POST, "https://example.com/", strings.NewReader(`{"name":"web"}`))
+	req.ContentLength = -1
+	_, err := readBody(req, 8)
+	assert.Equal(t, ErrBodyTooLarge, err, "bodies of unknown length are cut off at the limit")
+
+	req, _ = http.NewRequest(POST, "https://example.com/", strings.NewReader(`{}`))
+	b, err := readBody(req, 8)
+	assert.Nil(t, err)
+	assert.Equal(t, "{}", string(b))
+}
@@ -18,6 +18,7 @@ limitations under the License.
 package application
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -63,108 +64,166 @@ type Certificates struct {
 	CertificateChain string `json:"certificate_chain,omitempty"`
 }
 
+//Service issues Application requests with an explicitly configured kumoru.Client.
+type Service struct {
+	client *kumoru.Client
+}
+
+//NewService returns a Service which uses client as the template for each request.
+func NewService(client *kumoru.Client) *Service {
+	return &Service{client: client}
+}
+
 //Application Methods
 
 //Create is a method on an Application which requests that the application be drafted in Kumoru.
 func (a *Application) Create() (*Application, *http.Response, []error) {
-	var errs []error
-	k := kumoru.New()
+	return a.CreateContext(context.Background())
+}
+
+//CreateContext is like Create but the request is bound to ctx.
+func (a *Application) CreateContext(ctx context.Context) (*Application, *http.Response, []error) {
+	app, resp, err := NewService(kumoru.New()).Create(ctx, a)
+	return app, resp, kumoru.ErrorList(err)
+}
+
+//Delete is a method on an Application which request an Application be deleted in Kumoru.
+func (a *Application) Delete() (*Application, *http.Response, []error) {
+	return a.DeleteContext(context.Background())
+}
+
+//DeleteContext is like Delete but the request is bound to ctx.
+func (a *Application) DeleteContext(ctx context.Context) (*Application, *http.Response, []error) {
+	app, resp, err := NewService(kumoru.New()).Delete(ctx, a)
+	return app, resp, kumoru.ErrorList(err)
+}
+
+// Deploy is method on an Application which will cause a deployment in Kumoru.
+func (a *Application) Deploy() (*Application, *http.Response, []error) {
+	return a.DeployContext(context.Background())
+}
+
+// DeployContext is like Deploy but the request is bound to ctx.
+func (a *Application) DeployContext(ctx context.Context) (*Application, *http.Response, []error) {
+	app, resp, err := NewService(kumoru.New()).Deploy(ctx, a)
+	return app, resp, kumoru.ErrorList(err)
+}
+
+// Patch is a method on an application which will modify an existing Application.
+func (a *Application) Patch(patchedApplication *Application) (*Application, *http.Response, []error) {
+	return a.PatchContext(context.Background(), patchedApplication)
+}
+
+// PatchContext is like Patch but the request is bound to ctx.
+func (a *Application) PatchContext(ctx context.Context, patchedApplication *Application) (*Application, *http.Response, []error) {
+	app, resp, err := NewService(kumoru.New()).Patch(ctx, a, patchedApplication)
+	return app, resp, kumoru.ErrorList(err)
+}
+
+//Show is a method on an Application which retrieves a particular Application from Kumoru.
+func (a *Application) Show() (*Application, *http.Response, []error) {
+	return a.ShowContext(context.Background())
+}
+
+//ShowContext is like Show but the request is bound to ctx.
+func (a *Application) ShowContext(ctx context.Context) (*Application, *http.Response, []error) {
+	app, resp, err := NewService(kumoru.New()).Show(ctx, a)
+	return app, resp, kumoru.ErrorList(err)
+}
+
+// General functions not explicitly tied to an Application Struct
+
+// List retrieves a list of Applications a role has access to.
+func List() (*http.Response, string, []error) {
+	return ListContext(context.Background())
+}
+
+// ListContext is like List but the request is bound to ctx.
+func ListContext(ctx context.Context) (*http.Response, string, []error) {
+	resp, body, err := NewService(kumoru.New()).List(ctx)
+	return resp, body, kumoru.ErrorList(err)
+}
+
+//Service Methods
+
+//Create requests that the application a be drafted in Kumoru.
+func (svc *Service) Create(ctx context.Context, a *Application) (*Application, *http.Response, error) {
+	k := svc.client.Clone()
 
 	k.Post(fmt.Sprintf("%s/v1/applications/", k.EndPoint.Application))
 	k.TargetType = "json"
 	s, err := json.Marshal(*a)
 
 	if err != nil {
-		errs = append(errs, fmt.Errorf("%s", err))
-		return a, nil, errs
+		return a, nil, err
 	}
 
 	k.RawString = string(s)
 	k.SignRequest(true)
 
-	resp, body, errs := k.End()
-
-	if len(errs) > 0 {
-		return a, resp, errs
-	}
-
-	if resp.StatusCode >= 400 {
-		errs = append(errs, fmt.Errorf("%s", resp.Status))
-	}
-
-	err = json.Unmarshal([]byte(body), &a)
+	resp, err := k.EndJSON(ctx, a)
 
 	if err != nil {
-		errs = append(errs, err)
-		return a, resp, errs
+		return a, resp, err
 	}
 
 	return a, resp, nil
 }
 
-//Delete is a method on an Application which request an Application be deleted in Kumoru.
-func (a *Application) Delete() (*Application, *http.Response, []error) {
-	k := kumoru.New()
+//Delete requests the application a be deleted in Kumoru.
+func (svc *Service) Delete(ctx context.Context, a *Application) (*Application, *http.Response, error) {
+	k := svc.client.Clone()
 
 	k.Delete(fmt.Sprintf("%s/v1/applications/%s", k.EndPoint.Application, a.UUID))
 	k.SignRequest(true)
 
-	resp, _, errs := k.End()
+	resp, body, errs := k.EndContext(ctx)
 
 	if len(errs) > 0 {
-		return a, resp, errs
-	}
-
-	if resp.StatusCode >= 400 {
-		errs = append(errs, fmt.Errorf("%s", resp.Status))
+		return a, resp, errs[0]
 	}
 
-	return a, resp, nil
+	return a, resp, k.CheckResponse(resp, []byte(body))
 }
 
-// Deploy is method on an Application which will cause a deployment in Kumoru.
-func (a *Application) Deploy() (*Application, *http.Response, []error) {
-	k := kumoru.New()
+// Deploy causes a deployment of the application a in Kumoru.
+func (svc *Service) Deploy(ctx context.Context, a *Application) (*Application, *http.Response, error) {
+	k := svc.client.Clone()
 
 	k.Post(fmt.Sprintf("%s/v1/applications/%s/deployments/?deployment_token=%s", k.EndPoint.Application, a.UUID, a.DeploymentToken))
 	k.SignRequest(true)
 
-	resp, _, errs := k.End()
+	resp, body, errs := k.EndContext(ctx)
 
 	if len(errs) > 0 {
-		return a, resp, errs
-	}
-
-	if resp.StatusCode >= 400 {
-		errs = append(errs, fmt.Errorf("%s", resp.Status))
+		return a, resp, errs[0]
 	}
 
-	return a, resp, nil
+	return a, resp, k.CheckResponse(resp, []byte(body))
 }
 
-// Patch is a method on an application which will modify an existing Application.
-func (a *Application) Patch(patchedApplication *Application) (*Application, *http.Response, []error) {
+// Patch modifies the existing application a so that it matches patchedApplication.
+func (svc *Service) Patch(ctx context.Context, a *Application, patchedApplication *Application) (*Application, *http.Response, error) {
 	o, err := json.Marshal(a)
 	if err != nil {
-		return nil, nil, []error{err}
+		return nil, nil, err
 	}
 
 	p, err := json.Marshal(patchedApplication)
 	if err != nil {
-		return nil, nil, []error{err}
+		return nil, nil, err
 	}
 
 	patch, err := jsonpatch.CreatePatch([]byte(o), []byte(p))
 	if err != nil {
-		fmt.Printf("Error creating JSON patch:%v", err)
-		return nil, nil, []error{err}
+		return nil, nil, fmt.Errorf("Error creating JSON patch: %s", err)
 	}
 
 	patchBytes, err := json.Marshal(patch)
 	if err != nil {
-		return nil, nil, []error{err}
+		return nil, nil, err
 	}
-	k := kumoru.New()
+	k := svc.client.Clone()
 
 	k.Logger.Debugf("Patch string: %s", patchBytes)
 
@@ -173,61 +232,89 @@ func (a *Application) Patch(patchedApplication *Application) (*Application, *htt
 	k.RawString = string(string(patchBytes))
 	k.SignRequest(true)
 
-	resp, body, errs := k.End()
+	pApp := Application{}
+	resp, err := k.EndJSON(ctx, &pApp)
 
-	if len(errs) > 0 {
-		return a, resp, errs
+	if err != nil {
+		return a, resp, err
 	}
 
-	if resp.StatusCode >= 400 {
-		errs = append(errs, fmt.Errorf("%s", resp.Status))
+	if kumoru.IsDryRun(resp) {
+		return patchedApplication, resp, nil
 	}
 
-	pApp := Application{}
-	err = json.Unmarshal([]byte(body), &pApp)
+	return &pApp, resp, nil
+}
+
+//Show retrieves the application identified by a.UUID from Kumoru.
+func (svc *Service) Show(ctx context.Context, a *Application) (*Application, *http.Response, error) {
+	k := svc.client.Clone()
+
+	k.Get(fmt.Sprintf("%s/v1/applications/%s", k.EndPoint.Application, a.UUID))
+	k.SignRequest(true)
+
+	resp, err := k.EndJSON(ctx, a)
 
 	if err != nil {
-		errs = append(errs, err)
-		return a, resp, errs
+		return a, resp, err
 	}
 
-	return &pApp, resp, nil
+	return a, resp, nil
 }
 
-//Show is a method on an Application which retrieves a particular Application from Kumoru.
-func (a *Application) Show() (*Application, *http.Response, []error) {
-	k := kumoru.New()
+// List retrieves a list of Applications the client's role has access to.
+func (svc *Service) List(ctx context.Context) (*http.Response, string, error) {
+	k := svc.client.Clone()
 
-	k.Get(fmt.Sprintf("%s/v1/applications/%s", k.EndPoint.Application, a.UUID))
+	k.Get(fmt.Sprintf("%s/v1/applications/", k.EndPoint.Application))
 	k.SignRequest(true)
 
-	resp, body, errs := k.End()
+	resp, body, errs := k.EndContext(ctx)
 
 	if len(errs) > 0 {
-		return a, resp, errs
+		return resp, body, errs[0]
 	}
 
-	if resp.StatusCode >= 400 {
-		errs = append(errs, fmt.Errorf("%s", resp.Status))
-	}
+	return resp, body, k.CheckResponse(resp, []byte(body))
+}
+
+//Iterate returns an Iterator over the Applications a role has access to, fetching them a page at a time.
+func (svc *Service) Iterate(opts kumoru.PageOptions) *Iterator {
+	k := svc.client
+	return &Iterator{pager: kumoru.NewPager(k, fmt.Sprintf("%s/v1/applications/", k.EndPoint.Application), opts)}
+}
 
-	err := json.Unmarshal([]byte(body), &a)
+// Iterator walks a list of Applications, fetching pages as they are needed
+type Iterator struct {
+	pager   *kumoru.Pager
+	current Application
+	err     error
+}
 
-	if err != nil {
-		errs = append(errs, fmt.Errorf("%s", err))
-		return a, resp, errs
+// Next advances to the next Application. It returns false at the end of the list or on error.
+func (it *Iterator) Next(ctx context.Context) bool {
+	if it.err != nil || !it.pager.Next(ctx) {
+		return false
 	}
 
-	return a, resp, nil
-}
+	it.current = Application{}
+	if it.err = it.pager.Decode(&it.current); it.err != nil {
+		return false
+	}
 
-// General functions not explicitly tied to an Application Struct
+	return true
+}
 
-// List retrieves a list of Applications a role has access to.
-func List() (*http.Response, string, []error) {
-	k := kumoru.New()
+// Application returns the current Application
+func (it *Iterator) Application() *Application {
+	v := it.current
+	return &v
+}
 
-	k.Get(fmt.Sprintf("%s/v1/applications/", k.EndPoint.Application))
-	k.SignRequest(true)
-	return k.End()
+// Err returns the error which stopped iteration, if any
+func (it *Iterator) Err() error {
+	if it.err != nil {
+		return it.err
+	}
+	return it.pager.Err()
 }
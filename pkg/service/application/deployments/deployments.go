@@ -17,7 +17,7 @@ limitations under the License.
 package deployments
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"net/http"
 
@@ -38,50 +38,111 @@ type Deployment struct {
 	Uuid            string                 `json:"uuid"`
 }
 
+// Service issues Deployment requests with an explicitly configured kumoru.Client
+type Service struct {
+	client *kumoru.Client
+}
+
+// NewService returns a Service which uses client as the template for each request
+func NewService(client *kumoru.Client) *Service {
+	return &Service{client: client}
+}
+
 // List is a method will call the appropriate URI and return a list of all deployments
 func (d *Deployment) List(applicationUuid string) (*[]Deployment, *http.Response, []error) {
+	return d.ListContext(context.Background(), applicationUuid)
+}
+
+// ListContext is like List but the request is bound to ctx
+func (d *Deployment) ListContext(ctx context.Context, applicationUuid string) (*[]Deployment, *http.Response, []error) {
+	deployments, resp, err := NewService(kumoru.New()).List(ctx, applicationUuid)
+	return deployments, resp, kumoru.ErrorList(err)
+}
+
+// Show is a method will call the appropriate URI and return a specific deployment
+func (d *Deployment) Show(applicationUuid, deploymentUuid string) (*Deployment, *http.Response, []error) {
+	return d.ShowContext(context.Background(), applicationUuid, deploymentUuid)
+}
+
+// ShowContext is like Show but the request is bound to ctx
+func (d *Deployment) ShowContext(ctx context.Context, applicationUuid, deploymentUuid string) (*Deployment, *http.Response, []error) {
+	deployment, resp, err := NewService(kumoru.New()).Show(ctx, applicationUuid, deploymentUuid)
+	return deployment, resp, kumoru.ErrorList(err)
+}
+
+//Service Methods
+
+// List calls the appropriate URI and returns a list of all deployments of an application
+func (svc *Service) List(ctx context.Context, applicationUuid string) (*[]Deployment, *http.Response, error) {
 	deployments := []Deployment{}
-	k := kumoru.New()
+	k := svc.client.Clone()
 
 	k.Get(fmt.Sprintf("%s/v1/applications/%s/deployments/", k.EndPoint.Application, applicationUuid))
 	k.SignRequest(true)
 
-	resp, body, errs := k.End()
-
-	if errs != nil {
-		return &deployments, resp, errs
-	}
-
-	err := json.Unmarshal([]byte(body), &deployments)
+	resp, err := k.EndJSON(ctx, &deployments)
 
 	if err != nil {
-		errs = append(errs, err)
-		return &deployments, resp, errs
+		return &deployments, resp, err
 	}
 
 	return &deployments, resp, nil
 }
 
-// Show is a method will call the appropriate URI and return a specific deployment
-func (d *Deployment) Show(applicationUuid, deploymentUuid string) (*Deployment, *http.Response, []error) {
+// Show calls the appropriate URI and returns a specific deployment
+func (svc *Service) Show(ctx context.Context, applicationUuid, deploymentUuid string) (*Deployment, *http.Response, error) {
 	deployment := Deployment{}
-	k := kumoru.New()
+	k := svc.client.Clone()
 
 	k.Get(fmt.Sprintf("%s/v1/applications/%s/deployments/%s", k.EndPoint.Application, applicationUuid, deploymentUuid))
 	k.SignRequest(true)
 
-	resp, body, errs := k.End()
+	resp, err := k.EndJSON(ctx, &deployment)
 
-	if errs != nil {
-		return &deployment, resp, errs
+	if err != nil {
+		return &deployment, resp, err
 	}
 
-	err := json.Unmarshal([]byte(body), &deployment)
+	return &deployment, resp, nil
+}
 
-	if err != nil {
-		errs = append(errs, err)
-		return &deployment, resp, errs
+// Iterate returns an Iterator over the Deployments of an Application, fetching them a page at a time.
+func (svc *Service) Iterate(applicationUuid string, opts kumoru.PageOptions) *Iterator {
+	k := svc.client
+	return &Iterator{pager: kumoru.NewPager(k, fmt.Sprintf("%s/v1/applications/%s/deployments/", k.EndPoint.Application, applicationUuid), opts)}
+}
+
+// Iterator walks a list of Deployments, fetching pages as they are needed
+type Iterator struct {
+	pager   *kumoru.Pager
+	current Deployment
+	err     error
+}
+
+// Next advances to the next Deployment. It returns false at the end of the list or on error.
+func (it *Iterator) Next(ctx context.Context) bool {
+	if it.err != nil || !it.pager.Next(ctx) {
+		return false
+	}
+
+	it.current = Deployment{}
+	if it.err = it.pager.Decode(&it.current); it.err != nil {
+		return false
 	}
 
-	return &deployment, resp, errs
+	return true
+}
+
+// Deployment returns the current Deployment
+func (it *Iterator) Deployment() *Deployment {
+	v := it.current
+	return &v
+}
+
+// Err returns the error which stopped iteration, if any
+func (it *Iterator) Err() error {
+	if it.err != nil {
+		return it.err
+	}
+	return it.pager.Err()
 }
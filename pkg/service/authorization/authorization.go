@@ -18,7 +18,7 @@ limitations under the License.
 package authorization
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"net/http"
 
@@ -36,81 +36,124 @@ type Account struct {
 	UpdatedAt string `json:"updated_at"`
 }
 
+//Service issues account and token requests with an explicitly configured kumoru.Client.
+type Service struct {
+	client *kumoru.Client
+}
+
+//NewService returns a Service which uses client as the template for each request.
+func NewService(client *kumoru.Client) *Service {
+	return &Service{client: client}
+}
+
 //CreateAcct requests a particular account be made in Kumoru.
 //It returns the updated Account.
 func (a *Account) CreateAcct(password string) (*Account, *http.Response, []error) {
-	k := kumoru.New()
+	return a.CreateAcctContext(context.Background(), password)
+}
 
-	k.Put(fmt.Sprintf("%s/v1/accounts/%s", k.EndPoint.Authorization, a.Email))
-	k.Send(fmt.Sprintf("given_name=%s&surname=%s&password=%s", a.GivenName, a.Surname, password))
+//CreateAcctContext is like CreateAcct but the request is bound to ctx.
+func (a *Account) CreateAcctContext(ctx context.Context, password string) (*Account, *http.Response, []error) {
+	account, resp, err := NewService(kumoru.New()).CreateAcct(ctx, a, password)
+	return account, resp, kumoru.ErrorList(err)
+}
 
-	resp, body, errs := k.End()
+//ResetPassword requests the password be reset for a given Account.
+func (a *Account) ResetPassword() (*Account, *http.Response, []error) {
+	return a.ResetPasswordContext(context.Background())
+}
 
-	if len(errs) > 0 {
-		return a, resp, errs
-	}
+//ResetPasswordContext is like ResetPassword but the request is bound to ctx.
+func (a *Account) ResetPasswordContext(ctx context.Context) (*Account, *http.Response, []error) {
+	account, resp, err := NewService(kumoru.New()).ResetPassword(ctx, a)
+	return account, resp, kumoru.ErrorList(err)
+}
 
-	if resp.StatusCode >= 400 {
-		errs = append(errs, fmt.Errorf("%s", resp.Status))
-	}
+//Show requests account details from Kumoru and marshals the data into the Account type.
+func (a *Account) Show() (*Account, *http.Response, []error) {
+	return a.ShowContext(context.Background())
+}
+
+//ShowContext is like Show but the request is bound to ctx.
+func (a *Account) ShowContext(ctx context.Context) (*Account, *http.Response, []error) {
+	account, resp, err := NewService(kumoru.New()).Show(ctx, a)
+	return account, resp, kumoru.ErrorList(err)
+}
+
+//GetTokens generates a new token(uuid), stores this token in Kumoru and retrieves the private half of the token.
+func GetTokens(username, password string) (string, *http.Response, string, []error) {
+	return GetTokensContext(context.Background(), username, password)
+}
 
-	err := json.Unmarshal([]byte(body), &a)
+//GetTokensContext is like GetTokens but the request is bound to ctx.
+func GetTokensContext(ctx context.Context, username, password string) (string, *http.Response, string, []error) {
+	token, resp, body, err := NewService(kumoru.New()).GetTokens(ctx, username, password)
+	return token, resp, body, kumoru.ErrorList(err)
+}
+
+//Service Methods
+
+//CreateAcct requests the account a be made in Kumoru.
+//It returns the updated Account.
+func (svc *Service) CreateAcct(ctx context.Context, a *Account, password string) (*Account, *http.Response, error) {
+	k := svc.client.Clone()
+
+	k.Put(fmt.Sprintf("%s/v1/accounts/%s", k.EndPoint.Authorization, a.Email))
+	k.Send(fmt.Sprintf("given_name=%s&surname=%s&password=%s", a.GivenName, a.Surname, password))
+
+	resp, err := k.EndJSON(ctx, a)
 
 	if err != nil {
-		errs = append(errs, err)
-		return a, resp, errs
+		return a, resp, err
 	}
 
 	return a, resp, nil
 }
 
-//ResetPassword requests the password be reset for a given Account.
-func (a *Account) ResetPassword() (*Account, *http.Response, []error) {
-	k := kumoru.New()
+//ResetPassword requests the password be reset for the account a.
+func (svc *Service) ResetPassword(ctx context.Context, a *Account) (*Account, *http.Response, error) {
+	k := svc.client.Clone()
 
 	k.Get(fmt.Sprintf("%v/v1/accounts/%v/password/resets/", k.EndPoint.Authorization, a.Email))
-	resp, _, errs := k.End()
+	k.SetMutating(true)
+	resp, body, errs := k.EndContext(ctx)
+
+	if len(errs) > 0 {
+		return a, resp, errs[0]
+	}
 
-	return a, resp, errs
+	return a, resp, k.CheckResponse(resp, []byte(body))
 }
 
-//Show requests account details from Kumoru and marshals the data into the Account type.
-func (a *Account) Show() (*Account, *http.Response, []error) {
-	k := kumoru.New()
+//Show requests details of the account a from Kumoru and marshals the data into it.
+func (svc *Service) Show(ctx context.Context, a *Account) (*Account, *http.Response, error) {
+	k := svc.client.Clone()
 
 	k.Get(fmt.Sprintf("%v/v1/accounts/%v", k.EndPoint.Authorization, a.Email))
 	k.SignRequest(true)
 
-	resp, body, errs := k.End()
-
-	if len(errs) > 0 {
-		return a, resp, errs
-	}
-
-	if resp.StatusCode >= 400 {
-		errs = append(errs, fmt.Errorf("%s", resp.Status))
-		return a, resp, errs
-	}
-
-	err := json.Unmarshal([]byte(body), &a)
+	resp, err := k.EndJSON(ctx, a)
 
 	if err != nil {
-		errs = append(errs, err)
-		return a, resp, errs
+		return a, resp, err
 	}
 
 	return a, resp, nil
 }
 
 //GetTokens generates a new token(uuid), stores this token in Kumoru and retrieves the private half of the token.
-func GetTokens(username, password string) (string, *http.Response, string, []error) {
-	k := kumoru.New()
+func (svc *Service) GetTokens(ctx context.Context, username, password string) (string, *http.Response, string, error) {
+	k := svc.client.Clone()
 
 	token := uuid.New()
 
 	k.Put(fmt.Sprintf("%v/v1/tokens/%v", k.EndPoint.Authorization, token))
 	k.SetBasicAuth(username, password)
-	resp, body, errs := k.End()
+	resp, body, errs := k.EndContext(ctx)
+
+	if len(errs) > 0 {
+		return token, resp, body, errs[0]
+	}
 
-	return token, resp, body, errs
+	return token, resp, body, k.CheckResponse(resp, []byte(body))
 }
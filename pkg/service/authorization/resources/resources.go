@@ -17,6 +17,7 @@ limitations under the License.
 package resources
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 
@@ -32,8 +33,31 @@ type Resource struct {
 	Context    string `json:"context"`
 }
 
+// Service issues Resource requests with an explicitly configured kumoru.Client
+type Service struct {
+	client *kumoru.Client
+}
+
+// NewService returns a Service which uses client as the template for each request
+func NewService(client *kumoru.Client) *Service {
+	return &Service{client: client}
+}
+
 // Find resources that are accesible to the requester
 func Find(rType, action, identifier string, wrappedRequest *http.Request) (*http.Response, string, []error) {
+	return FindContext(context.Background(), rType, action, identifier, wrappedRequest)
+}
+
+// FindContext is like Find but the request is bound to ctx
+func FindContext(ctx context.Context, rType, action, identifier string, wrappedRequest *http.Request) (*http.Response, string, []error) {
+	resp, body, err := NewService(kumoru.New()).Find(ctx, rType, action, identifier, wrappedRequest)
+	return resp, body, kumoru.ErrorList(err)
+}
+
+//Service Methods
+
+// Find resources that are accesible to the client's role
+func (svc *Service) Find(ctx context.Context, rType, action, identifier string, wrappedRequest *http.Request) (*http.Response, string, error) {
 	params := "select_by="
 	params += fmt.Sprintf("type=%s,", rType)
 	params += fmt.Sprintf("action=%s", action)
@@ -43,7 +67,7 @@ func Find(rType, action, identifier string, wrappedRequest *http.Request) (*http
 
 	fmt.Println("Params: ", params)
 
-	k := kumoru.New()
+	k := svc.client.Clone()
 	k.Get(fmt.Sprintf("%s/v1/resources/", k.EndPoint.Authorization))
 	k.Query(params)
 	if wrappedRequest != nil {
@@ -54,5 +78,11 @@ func Find(rType, action, identifier string, wrappedRequest *http.Request) (*http
 	}
 	k.SignRequest(true)
 
-	return k.End()
+	resp, body, errs := k.EndContext(ctx)
+
+	if len(errs) > 0 {
+		return resp, body, errs[0]
+	}
+
+	return resp, body, k.CheckResponse(resp, []byte(body))
 }
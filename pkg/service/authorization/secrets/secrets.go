@@ -17,7 +17,7 @@ limitations under the License.
 package secrets
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"net/http"
 	"net/url"
@@ -33,76 +33,97 @@ type Secret struct {
 	Value     string   `"json: value"`
 }
 
+// Service issues Secret requests with an explicitly configured kumoru.Client
+type Service struct {
+	client *kumoru.Client
+}
+
+// NewService returns a Service which uses client as the template for each request
+func NewService(client *kumoru.Client) *Service {
+	return &Service{client: client}
+}
+
 // Create is a Secret method that will create a secret with the specified value
 func (s *Secret) Create() (*Secret, *http.Response, []error) {
-	k := kumoru.New()
+	return s.CreateContext(context.Background())
+}
+
+// CreateContext is like Create but the request is bound to ctx
+func (s *Secret) CreateContext(ctx context.Context) (*Secret, *http.Response, []error) {
+	secret, resp, err := NewService(kumoru.New()).Create(ctx, s)
+	return secret, resp, kumoru.ErrorList(err)
+}
+
+// Show is a Secret method will call the appropriate URI and return a specific secret
+func (s *Secret) Show(secretUuid *string) (*Secret, *http.Response, []error) {
+	return s.ShowContext(context.Background(), secretUuid)
+}
+
+// ShowContext is like Show but the request is bound to ctx
+func (s *Secret) ShowContext(ctx context.Context, secretUuid *string) (*Secret, *http.Response, []error) {
+	secret, resp, err := NewService(kumoru.New()).Show(ctx, secretUuid)
+	return secret, resp, kumoru.ErrorList(err)
+}
+
+//List retreives all secrets a role has access to
+func List() ([]*Secret, *http.Response, []error) {
+	return ListContext(context.Background())
+}
+
+//ListContext is like List but the request is bound to ctx
+func ListContext(ctx context.Context) ([]*Secret, *http.Response, []error) {
+	secrets, resp, err := NewService(kumoru.New()).List(ctx)
+	return secrets, resp, kumoru.ErrorList(err)
+}
+
+//Service Methods
+
+// Create creates a secret with the value and labels of s
+func (svc *Service) Create(ctx context.Context, s *Secret) (*Secret, *http.Response, error) {
+	k := svc.client.Clone()
 
 	k.Post(fmt.Sprintf("%v/v1/secrets/", k.EndPoint.Authorization))
 	k.Send(genParameters(s.Value, s.Labels))
 	k.SignRequest(true)
 
-	resp, body, errs := k.End()
-
-	if errs != nil {
-		return s, resp, errs
-	}
-
-	err := json.Unmarshal([]byte(body), &s)
+	resp, err := k.EndJSON(ctx, s)
 
 	if err != nil {
-		errs = append(errs, err)
-		return s, resp, errs
+		return s, resp, err
 	}
 
 	return s, resp, nil
 }
 
-// Show is a Secret method will call the appropriate URI and return a specific secret
-func (s *Secret) Show(secretUuid *string) (*Secret, *http.Response, []error) {
+// Show calls the appropriate URI and returns a specific secret
+func (svc *Service) Show(ctx context.Context, secretUuid *string) (*Secret, *http.Response, error) {
 	secret := Secret{}
-	k := kumoru.New()
+	k := svc.client.Clone()
 
 	k.Get(fmt.Sprintf("%s/v1/secrets/%s", k.EndPoint.Authorization, *secretUuid))
 	k.SignRequest(true)
 
-	resp, body, errs := k.End()
-
-	if errs != nil {
-		return &secret, resp, errs
-	}
-
-	err := json.Unmarshal([]byte(body), &secret)
+	resp, err := k.EndJSON(ctx, &secret)
 
 	if err != nil {
-		errs = append(errs, err)
-		return &secret, resp, errs
+		return &secret, resp, err
 	}
 
-	return &secret, resp, errs
+	return &secret, resp, nil
 }
 
-//List retreives all secrets a role has access to
-func List() ([]*Secret, *http.Response, []error) {
+//List retreives all secrets the client's role has access to
+func (svc *Service) List(ctx context.Context) ([]*Secret, *http.Response, error) {
 	apps := []*Secret{}
-	k := kumoru.New()
+	k := svc.client.Clone()
 
 	k.Get(fmt.Sprintf("%s/v1/secrets/", k.EndPoint.Authorization))
 	k.SignRequest(true)
 
-	resp, body, errs := k.End()
-
-	if len(errs) > 0 {
-		return nil, resp, errs
-	}
-
-	if resp.StatusCode >= 400 {
-		errs = append(errs, fmt.Errorf("%s", resp.Status))
-	}
-
-	err := json.Unmarshal([]byte(body), &apps)
+	resp, err := k.EndJSON(ctx, &apps)
 
 	if err != nil {
-		errs = append(errs, fmt.Errorf("%s", err))
+		return nil, resp, err
 	}
 
 	return apps, resp, nil
@@ -122,3 +143,44 @@ func genParameters(value string, labels []string) string {
 
 	return params
 }
+
+// Iterate returns an Iterator over the secrets a role has access to, fetching them a page at a time.
+func (svc *Service) Iterate(opts kumoru.PageOptions) *Iterator {
+	k := svc.client
+	return &Iterator{pager: kumoru.NewPager(k, fmt.Sprintf("%s/v1/secrets/", k.EndPoint.Authorization), opts)}
+}
+
+// Iterator walks a list of Secrets, fetching pages as they are needed
+type Iterator struct {
+	pager   *kumoru.Pager
+	current Secret
+	err     error
+}
+
+// Next advances to the next Secret. It returns false at the end of the list or on error.
+func (it *Iterator) Next(ctx context.Context) bool {
+	if it.err != nil || !it.pager.Next(ctx) {
+		return false
+	}
+
+	it.current = Secret{}
+	if it.err = it.pager.Decode(&it.current); it.err != nil {
+		return false
+	}
+
+	return true
+}
+
+// Secret returns the current Secret
+func (it *Iterator) Secret() *Secret {
+	v := it.current
+	return &v
+}
+
+// Err returns the error which stopped iteration, if any
+func (it *Iterator) Err() error {
+	if it.err != nil {
+		return it.err
+	}
+	return it.pager.Err()
+}
@@ -17,7 +17,9 @@ limitations under the License.
 package location
 
 import (
+	"context"
 	"fmt"
+	"net/http"
 
 	"github.com/kumoru/kumoru-sdk-go/pkg/kumoru"
 )
@@ -29,65 +31,174 @@ type Location struct {
 	Region           string `json:"region"`
 }
 
+//Service issues Location requests with an explicitly configured kumoru.Client
+type Service struct {
+	client *kumoru.Client
+}
+
+//NewService returns a Service which uses client as the template for each request
+func NewService(client *kumoru.Client) *Service {
+	return &Service{client: client}
+}
+
 //Create is a method which will request a Location be created
 func (l *Location) Create() (string, []error) {
-	k := kumoru.New()
+	return l.CreateContext(context.Background())
+}
+
+//CreateContext is like Create but the request is bound to ctx
+func (l *Location) CreateContext(ctx context.Context) (string, []error) {
+	body, _, err := NewService(kumoru.New()).Create(ctx, l)
+	return body, kumoru.ErrorList(err)
+}
+
+//Delete will request that a particular Location be removed
+func (l *Location) Delete() []error {
+	return l.DeleteContext(context.Background())
+}
+
+//DeleteContext is like Delete but the request is bound to ctx
+func (l *Location) DeleteContext(ctx context.Context) []error {
+	_, err := NewService(kumoru.New()).Delete(ctx, l)
+	return kumoru.ErrorList(err)
+}
+
+//Find is a method which will search for Locations based on inputs
+func (l *Location) Find() (string, []error) {
+	return l.FindContext(context.Background())
+}
+
+//FindContext is like Find but the request is bound to ctx
+func (l *Location) FindContext(ctx context.Context) (string, []error) {
+	body, _, err := NewService(kumoru.New()).Find(ctx, l)
+	return body, kumoru.ErrorList(err)
+}
+
+//buildFindPath uses elements from a Location to create a path that can be used during a GET on .../locations/...
+func (l *Location) buildFindPath(endpoint string) string {
+	path := fmt.Sprintf("%s/v1/locations/", endpoint)
+
+	if l.Provider != "" {
+		path = fmt.Sprintf("%s%s", path, l.Provider)
+
+		if l.Region != "" {
+			path = fmt.Sprintf("%s/%s", path, l.Region)
+		}
+	}
+
+	return path
+}
+
+//Service Methods
+
+//Create requests the Location l be created
+func (svc *Service) Create(ctx context.Context, l *Location) (string, *http.Response, error) {
+	k := svc.client.Clone()
 
 	k.Put(fmt.Sprintf("%s/v1/locations/%s/%s", k.EndPoint.Location, l.Provider, l.Region))
 	k.SignRequest(true)
 
-	resp, body, errs := k.End()
+	resp, body, errs := k.EndContext(ctx)
+
+	if len(errs) > 0 {
+		return string(body), resp, errs[0]
+	}
+
+	if err := k.CheckResponse(resp, []byte(body)); err != nil {
+		return string(body), resp, err
+	}
 
 	if resp.StatusCode != 201 {
-		errs = append(errs, fmt.Errorf("%s", resp.Status))
+		return string(body), resp, fmt.Errorf("unexpected status: %s", resp.Status)
 	}
 
-	return string(body), errs
+	return string(body), resp, nil
 }
 
-//Delete will request that a particular Location be removed
-func (l *Location) Delete() []error {
-	k := kumoru.New()
+//Delete requests that the Location l be removed
+func (svc *Service) Delete(ctx context.Context, l *Location) (*http.Response, error) {
+	k := svc.client.Clone()
 
 	k.Delete(fmt.Sprintf("%s/v1/locations/%s/%s", k.EndPoint.Location, l.Provider, l.Region))
 	k.SignRequest(true)
 
-	resp, _, errs := k.End()
+	resp, body, errs := k.EndContext(ctx)
+
+	if len(errs) > 0 {
+		return resp, errs[0]
+	}
+
+	if err := k.CheckResponse(resp, []byte(body)); err != nil {
+		return resp, err
+	}
 
 	if resp.StatusCode != 204 {
-		errs = append(errs, fmt.Errorf("s", resp.Status))
+		return resp, fmt.Errorf("unexpected status: %s", resp.Status)
 	}
 
-	return errs
+	return resp, nil
 }
 
-//Find is a method which will search for Locations based on inputs
-func (l *Location) Find() (string, []error) {
-	k := kumoru.New()
+//Find searches for Locations matching the non-empty fields of l
+func (svc *Service) Find(ctx context.Context, l *Location) (string, *http.Response, error) {
+	k := svc.client.Clone()
 
 	k.Get(l.buildFindPath(k.EndPoint.Location))
 	k.SignRequest(true)
 
-	resp, body, errs := k.End()
+	resp, body, errs := k.EndContext(ctx)
+
+	if len(errs) > 0 {
+		return string(body), resp, errs[0]
+	}
+
+	if err := k.CheckResponse(resp, []byte(body)); err != nil {
+		return string(body), resp, err
+	}
 
 	if resp.StatusCode != 200 {
-		errs = append(errs, fmt.Errorf("%s", resp.Status))
+		return string(body), resp, fmt.Errorf("unexpected status: %s", resp.Status)
 	}
 
-	return string(body), errs
+	return string(body), resp, nil
 }
 
-//buildFindPath uses elements from a Location to create a path that can be used during a GET on .../locations/...
-func (l *Location) buildFindPath(endpoint string) string {
-	path := fmt.Sprintf("%s/v1/locations/", endpoint)
+//Iterate returns an Iterator over the Locations matching the non-empty fields of l, fetching them a page at a time
+func (svc *Service) Iterate(l *Location, opts kumoru.PageOptions) *Iterator {
+	return &Iterator{pager: kumoru.NewPager(svc.client, l.buildFindPath(svc.client.EndPoint.Location), opts)}
+}
 
-	if l.Provider != "" {
-		path = fmt.Sprintf("%s%s", path, l.Provider)
+// Iterator walks a list of Locations, fetching pages as they are needed
+type Iterator struct {
+	pager   *kumoru.Pager
+	current Location
+	err     error
+}
 
-		if l.Region != "" {
-			path = fmt.Sprintf("%s/%s", path, l.Region)
-		}
+// Next advances to the next Location. It returns false at the end of the list or on error.
+func (it *Iterator) Next(ctx context.Context) bool {
+	if it.err != nil || !it.pager.Next(ctx) {
+		return false
 	}
 
-	return path
+	it.current = Location{}
+	if it.err = it.pager.Decode(&it.current); it.err != nil {
+		return false
+	}
+
+	return true
+}
+
+// Location returns the current Location
+func (it *Iterator) Location() *Location {
+	v := it.current
+	return &v
+}
+
+// Err returns the error which stopped iteration, if any
+func (it *Iterator) Err() error {
+	if it.err != nil {
+		return it.err
+	}
+	return it.pager.Err()
 }
@@ -1,8 +1,13 @@
 package location
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
 	"testing"
+
+	"github.com/kumoru/kumoru-sdk-go/pkg/kumoru"
 )
 
 func TestBuildFindPath(t *testing.T) {
@@ -38,3 +43,58 @@ func TestBuildFindPath(t *testing.T) {
 		}
 	}
 }
+
+func TestServiceFind(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/locations/amazon" {
+			t.Errorf("Expected path %q; got %q", "/v1/locations/amazon", r.URL.Path)
+		}
+		if r.Header.Get("X-Kumoru-Context") != "ROLE_UUID" {
+			t.Errorf("Expected context %q; got %q", "ROLE_UUID", r.Header.Get("X-Kumoru-Context"))
+		}
+		w.Write([]byte(`[{"provider":"amazon","region":"us-east-1"}]`))
+	}))
+	defer ts.Close()
+
+	svc := NewService(&kumoru.Client{
+		EndPoint: &kumoru.Endpoints{Location: ts.URL},
+		Tokens:   &kumoru.Ktokens{Public: "PUBLIC_TOKEN", Private: "PRIVATE_TOKEN"},
+		RoleUUID: "ROLE_UUID",
+	})
+
+	body, _, err := svc.Find(context.Background(), &Location{Provider: "amazon"})
+
+	if err != nil {
+		t.Fatalf("Expected no error; got %v", err)
+	}
+
+	expected := `[{"provider":"amazon","region":"us-east-1"}]`
+	if body != expected {
+		t.Errorf("result == %v, expected %v", body, expected)
+	}
+}
+
+func TestServiceFindNotFound(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Request-Id", "REQ-1")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"code":"location_not_found","message":"no such location"}`))
+	}))
+	defer ts.Close()
+
+	svc := NewService(&kumoru.Client{
+		EndPoint: &kumoru.Endpoints{Location: ts.URL},
+		Tokens:   &kumoru.Ktokens{Public: "PUBLIC_TOKEN", Private: "PRIVATE_TOKEN"},
+	})
+
+	_, _, err := svc.Find(context.Background(), &Location{Provider: "nowhere"})
+
+	if !kumoru.IsNotFound(err) {
+		t.Fatalf("Expected a not found error; got %v", err)
+	}
+
+	apiErr := err.(*kumoru.APIError)
+	if apiErr.Service != "location" || apiErr.Code != "location_not_found" || apiErr.RequestID != "REQ-1" {
+		t.Errorf("Unexpected error fields: %+v", apiErr)
+	}
+}